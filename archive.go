@@ -0,0 +1,239 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// 書類のzipのアーカイブ
+// ダウンロードしたzipを <ディレクトリ>/<docIDの5～6文字目>/<docIDの7～8文字目>/<docID>.zip に保存し、
+// SHA-256 とサイズを archived_files テーブルに記録する。
+// 記録と一致するzipがあれば、EDINET APIからダウンロードせずに使用する。
+// 取り下げられた書類のzipは、書類一覧の取得時に削除する
+type zipArchive struct {
+	dir   string
+	files archiveStore // 保存したzipの記録
+}
+
+// アーカイブに保存した書類のzip
+type archivedFile struct {
+	DocID      string
+	Path       string // アーカイブのディレクトリからの相対パス（区切りは /）
+	SHA256     string // 16進数
+	Size       int64
+	ArchivedAt time.Time
+}
+
+// アーカイブを作成する。dir が空の場合はアーカイブを使用しない（nil を返す）
+func newZipArchive(dir string, files archiveStore) *zipArchive {
+	if dir == "" {
+		return nil
+	}
+	return &zipArchive{dir: dir, files: files}
+}
+
+// docIDのzipのアーカイブ内の相対パス
+// 1つのディレクトリにファイルが集中しないよう、docIDの5～8文字目で振り分ける
+// （EDINETのdocIDは先頭4文字が "S100" 等の固定の値のため、振り分けに使用しない）
+// 保存先は archived_files に記録するので、振り分け方を変える前に保存したzipもそのまま使用できる
+func archivePath(docID string) string {
+	if len(docID) < 8 {
+		return docID + ".zip"
+	}
+	return path.Join(docID[4:6], docID[6:8], docID+".zip")
+}
+
+// ファイルのSHA-256（16進数）とサイズを返す
+func fileDigest(name string) (string, int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// アーカイブにある書類のzipのパスを返す
+// 記録がない、ファイルがない、ファイルが記録と一致しない場合は ok に false を返す
+func (a *zipArchive) Lookup(docID string) (name string, ok bool, err error) {
+	f, err := a.files.ArchivedFile(docID)
+	if err != nil || f == nil {
+		return "", false, err
+	}
+
+	name = filepath.Join(a.dir, filepath.FromSlash(f.Path))
+	if problem := verifyArchivedFile(name, f); problem != "" {
+		log.Printf("%s アーカイブのzipを使用できません: %s", docID, problem)
+		return "", false, nil
+	}
+	return name, true, nil
+}
+
+// ファイルが記録と一致するか確認する。一致しない場合はその内容を返す
+func verifyArchivedFile(name string, f *archivedFile) string {
+	sum, size, err := fileDigest(name)
+	if os.IsNotExist(err) {
+		return "ファイルがありません"
+	}
+	if err != nil {
+		return err.Error()
+	}
+	if size != f.Size {
+		return fmt.Sprintf("サイズが記録と一致しません（記録 %d、実際 %d）", f.Size, size)
+	}
+	if sum != f.SHA256 {
+		return "SHA-256が記録と一致しません"
+	}
+	return ""
+}
+
+// ダウンロードしたzipをアーカイブに保存して記録し、保存先のパスを返す
+// 途中で失敗しても壊れたファイルが残らないよう、一時ファイルに書き込んでから名前を変更する
+func (a *zipArchive) Put(docID string, src string) (string, error) {
+	rel := archivePath(docID)
+	dst := filepath.Join(a.dir, filepath.FromSlash(rel))
+	err := os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return "", err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), docID+"_*.tmp")
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), in)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), dst)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	err = a.files.RecordArchivedFile(archivedFile{
+		DocID:  docID,
+		Path:   rel,
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+		Size:   size,
+	})
+	if err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+// 取り下げられた書類のzipを、アーカイブとその記録から削除する
+func (a *zipArchive) Purge(docID string) error {
+	f, err := a.files.ArchivedFile(docID)
+	if err != nil || f == nil {
+		return err
+	}
+
+	name := filepath.Join(a.dir, filepath.FromSlash(f.Path))
+	err = os.Remove(name)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	log.Printf("%s は取り下げられたため、アーカイブのzip（%s）を削除しました", docID, f.Path)
+	return a.files.DeleteArchivedFile(docID)
+}
+
+// アーカイブの検証で見つかった問題
+type archiveProblem struct {
+	DocID   string
+	Path    string
+	Problem string
+}
+
+// 記録されたすべてのzipが、記録どおりのサイズとSHA-256か検証する
+// 検証したファイル数と、問題のあったファイルを返す
+func (a *zipArchive) Verify() (int, []archiveProblem, error) {
+	files, err := a.files.ArchivedFiles()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	problems := make([]archiveProblem, 0)
+	for i := range files {
+		f := &files[i]
+		name := filepath.Join(a.dir, filepath.FromSlash(f.Path))
+		if problem := verifyArchivedFile(name, f); problem != "" {
+			problems = append(problems, archiveProblem{DocID: f.DocID, Path: name, Problem: problem})
+		}
+	}
+	return len(files), problems, nil
+}
+
+// archive: 書類のzipのアーカイブを操作する
+func runArchive(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "使い方: yakumo archive verify [オプション]")
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "verify":
+		fs := newFlagSet("archive verify", "")
+		dbf := addDBFlags(fs)
+		dir := fs.String("archive", os.Getenv("YAKUMO_ARCHIVE_DIR"), "書類のzipのアーカイブのディレクトリ（省略時は環境変数 YAKUMO_ARCHIVE_DIR）")
+		if code, ok := parseFlags(fs, args[1:]); !ok {
+			return code
+		}
+		if *dir == "" {
+			fmt.Fprintln(os.Stderr, "yakumo archive verify: -archive を指定してください")
+			return exitUsage
+		}
+		s, ok := connectStore(dbf)
+		if !ok {
+			return exitError
+		}
+		defer s.Close()
+
+		err := s.CheckSchema()
+		if err != nil {
+			log.Print(err)
+			return exitError
+		}
+
+		count, problems, err := newZipArchive(*dir, s).Verify()
+		if err != nil {
+			log.Print(err)
+			return exitError
+		}
+		for _, p := range problems {
+			fmt.Printf("%s %s: %s\n", p.DocID, p.Path, p.Problem)
+		}
+		log.Printf("アーカイブの検証結果: %d件中 問題あり %d件", count, len(problems))
+		if len(problems) > 0 {
+			return exitError
+		}
+
+	default:
+		fmt.Fprintf(os.Stderr, "yakumo archive: 不明なサブコマンドです: %s（verify）\n", args[0])
+		return exitUsage
+	}
+	return exitOK
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArchivePath(t *testing.T) {
+	tests := []struct {
+		docID string
+		want  string
+	}{
+		{"S100ABCD", "AB/CD/S100ABCD.zip"},
+		{"S100TEST", "TE/ST/S100TEST.zip"},
+		{"S100", "S100.zip"},
+	}
+	for _, tt := range tests {
+		if got := archivePath(tt.docID); got != tt.want {
+			t.Errorf("archivePath(%q) = %q, want %q", tt.docID, got, tt.want)
+		}
+	}
+}
+
+// テスト用の書類のzipを、ダウンロードした一時ファイルとしてコピーする
+func copyTestZip(t *testing.T) string {
+	t.Helper()
+	b, err := os.ReadFile("testdata/zip/S100TEST.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "download.zip")
+	err = os.WriteFile(name, b, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestZipArchive(t *testing.T) {
+	tests := []struct {
+		name        string
+		tamper      func(t *testing.T, name string) // アーカイブのzipを変更する（nil なら変更しない）
+		wantProblem bool
+	}{
+		{"記録どおり", nil, false},
+		{"ファイルがない", func(t *testing.T, name string) {
+			if err := os.Remove(name); err != nil {
+				t.Fatal(err)
+			}
+		}, true},
+		{"サイズが違う", func(t *testing.T, name string) {
+			if err := os.Truncate(name, 10); err != nil {
+				t.Fatal(err)
+			}
+		}, true},
+		{"内容が違う（サイズは同じ）", func(t *testing.T, name string) {
+			f, err := os.OpenFile(name, os.O_WRONLY, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if _, err := f.WriteAt([]byte("XX"), 0); err != nil {
+				t.Fatal(err)
+			}
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arc := newZipArchive(t.TempDir(), newTestStore(t))
+
+			stored, err := arc.Put("S100TEST", copyTestZip(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := filepath.Join(arc.dir, "TE", "ST", "S100TEST.zip"); stored != want {
+				t.Errorf("保存先 = %q, want %q", stored, want)
+			}
+			if tt.tamper != nil {
+				tt.tamper(t, stored)
+			}
+
+			name, ok, err := arc.Lookup("S100TEST")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok == tt.wantProblem || (ok && name != stored) {
+				t.Errorf("Lookup = (%q, %v), want ok = %v", name, ok, !tt.wantProblem)
+			}
+
+			count, problems, err := arc.Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != 1 || (len(problems) > 0) != tt.wantProblem {
+				t.Errorf("Verify = (%d, %+v), want 1件、問題あり %v", count, problems, tt.wantProblem)
+			}
+		})
+	}
+}
+
+func TestZipArchiveLookupNotArchived(t *testing.T) {
+	_, ok, err := newZipArchive(t.TempDir(), newTestStore(t)).Lookup("S100TEST")
+	if err != nil || ok {
+		t.Errorf("Lookup = (%v, %v), want (false, nil)", ok, err)
+	}
+}
+
+func TestZipArchivePurge(t *testing.T) {
+	s := newTestStore(t)
+	arc := newZipArchive(t.TempDir(), s)
+	stored, err := arc.Put("S100TEST", copyTestZip(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// アーカイブを使用しない場合は、zipも記録も残す
+	err = (&pipeline{store: s}).purgeArchive("S100TEST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f, err := s.ArchivedFile("S100TEST"); err != nil || f == nil {
+		t.Fatalf("記録が削除されました: %v", err)
+	}
+
+	err = (&pipeline{store: s, archive: arc}).purgeArchive("S100TEST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stored); !os.IsNotExist(err) {
+		t.Errorf("zipが削除されていません: %v", err)
+	}
+	f, err := s.ArchivedFile("S100TEST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f != nil {
+		t.Errorf("記録が削除されていません: %+v", f)
+	}
+}
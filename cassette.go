@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// EDINET APIのレスポンスの記録と再生
+// sync 等の -record で、EDINET APIのレスポンス（書類一覧のJSON、書類のzip）をリクエストごとにディレクトリ（カセット）に保存し、
+// -replay で、EDINET APIにアクセスせずにカセットのレスポンスを返す。
+// GetDocuments、DownloadZip の処理はそのままで、HTTPクライアントの Transport だけを差し替える
+//
+// カセットのファイル（APIキーはファイル名にも内容にも含めない）
+//
+//	documents.json_date=2024-06-27_type=2.json   レスポンスのステータスとヘッダー
+//	documents.json_date=2024-06-27_type=2.body   レスポンスのボディ
+//	documents_S100ABCD_type=1.json / .body       書類取得APIのレスポンス
+
+// 記録するレスポンスのヘッダー
+var cassetteHeaders = []string{"Content-Type", "Content-Disposition", "Retry-After"}
+
+// カセットに記録したレスポンスのステータスとヘッダー
+type cassetteResponse struct {
+	Method     string            `json:"method"`
+	URL        string            `json:"url"` // APIキーを除いたURL
+	StatusCode int               `json:"statusCode"`
+	Header     map[string]string `json:"header"`
+}
+
+// EDINET APIのレスポンスを記録または再生する http.RoundTripper
+type cassetteTransport struct {
+	dir    string
+	record bool              // true なら記録、false なら再生
+	next   http.RoundTripper // 記録する場合に実際にリクエストを送信する
+}
+
+// 記録用の Transport を作成する。ディレクトリがなければ作成する
+func newRecordTransport(dir string) (*cassetteTransport, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &cassetteTransport{dir: dir, record: true, next: http.DefaultTransport}, nil
+}
+
+// 再生用の Transport を作成する
+func newReplayTransport(dir string) (*cassetteTransport, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("カセットのディレクトリではありません: %s", dir)
+	}
+	return &cassetteTransport{dir: dir}, nil
+}
+
+// リクエストに対応するカセットのファイル名（拡張子なし）
+// ベースURLによらないよう、パスの最後の /documents 以降とAPIキー以外のクエリから作成する
+func cassetteName(u *url.URL) string {
+	p := u.Path
+	if i := strings.LastIndex(p, "/documents"); i >= 0 {
+		p = p[i+1:]
+	}
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+
+	q := u.Query()
+	q.Del("Subscription-Key")
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		parts = append(parts, k+"="+q.Get(k))
+	}
+
+	name := strings.Join(parts, "_")
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`\/:*?"<>|`, r) {
+			return '-'
+		}
+		return r
+	}, name)
+}
+
+// APIキーを除いたURL
+func cassetteURL(u *url.URL) string {
+	c := *u
+	q := c.Query()
+	q.Del("Subscription-Key")
+	c.RawQuery = q.Encode()
+	return c.String()
+}
+
+func (t *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := filepath.Join(t.dir, cassetteName(req.URL))
+	if t.record {
+		return t.recordResponse(req, base)
+	}
+	return t.replayResponse(req, base)
+}
+
+// リクエストを送信し、レスポンスをカセットに記録する
+// リトライ等で同じリクエストを複数回送信した場合は、最後のレスポンスを記録する
+func (t *cassetteTransport) recordResponse(req *http.Request, base string) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	c := cassetteResponse{
+		Method:     req.Method,
+		URL:        cassetteURL(req.URL),
+		StatusCode: resp.StatusCode,
+		Header:     make(map[string]string),
+	}
+	for _, h := range cassetteHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			c.Header[h] = v
+		}
+	}
+	meta, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	err = os.WriteFile(base+".body", body, 0644)
+	if err == nil {
+		err = os.WriteFile(base+".json", meta, 0644)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("カセットに記録できません: %w", err)
+	}
+	return resp, nil
+}
+
+// カセットに記録したレスポンスを返す
+func (t *cassetteTransport) replayResponse(req *http.Request, base string) (*http.Response, error) {
+	meta, err := os.ReadFile(base + ".json")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("カセットに記録されていないリクエストです: %s", cassetteURL(req.URL))
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c cassetteResponse
+	err = json.Unmarshal(meta, &c)
+	if err != nil {
+		return nil, fmt.Errorf("%s.json: %w", base, err)
+	}
+	body, err := os.ReadFile(base + ".body")
+	if err != nil {
+		return nil, err
+	}
+
+	header := make(http.Header)
+	for k, v := range c.Header {
+		header.Set(k, v)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", c.StatusCode, http.StatusText(c.StatusCode)),
+		StatusCode:    c.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// testdata/cassettes は、testdata のフィクスチャを返す yakumo fake-edinet から
+// backfill -from 2024-06-27 -to 2024-06-27 -record で記録したカセット
+const testCassette = "testdata/cassettes"
+
+func TestReplayCassette(t *testing.T) {
+	s := newTestStore(t)
+
+	cfg := defaultPipelineConfig
+	cfg.replayDir = testCassette
+	p, ok := newPipeline(s, cfg)
+	if !ok {
+		t.Fatal("カセットを開けません")
+	}
+
+	ctx := context.Background()
+	docs, err := GetDocuments(ctx, p.client, "2024-06-27")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := p.processDocuments(ctx, "2024-06-27", docs.Results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (pipelineResult{saved: 1}) {
+		t.Errorf("処理結果 = %+v, want 保存1件", res)
+	}
+	checkTestDocument(t, s)
+
+	// 記録されていないリクエストはEDINET APIにアクセスせずにエラーにする
+	_, err = GetDocuments(ctx, p.client, "2024-06-28")
+	if err == nil {
+		t.Error("記録されていない日付の書類一覧を取得できました")
+	}
+}
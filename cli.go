@@ -0,0 +1,932 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"yakumo/edinet"
+)
+
+// 終了コード
+const (
+	exitOK    = 0 // 正常終了
+	exitError = 1 // 処理中のエラー
+	exitUsage = 2 // 引数の誤り
+	// 一部の書類の処理に失敗した（failed_documents に記録し、それ以外は処理を完了した）
+	exitPartial = 3
+)
+
+// 日付の書式（EDINET APIの日付指定と同じ）
+const dateLayout = "2006-01-02"
+
+// サブコマンド
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+// サブコマンドの一覧
+var commands = []command{
+	{"sync", "直近の書類を取得して登録する", runSync},
+	{"backfill", "期間を指定して書類を取得して登録する", runBackfill},
+	{"retry-failed", "処理に失敗した書類を再処理する", runRetryFailed},
+	{"reindex", "全文検索インデックスを再構築する", runReindex},
+	{"reextract", "保存してあるzipからテキストを抽出し直す", runReextract},
+	{"import", "手元にある書類のzipをEDINET APIを使わずに登録する", runImport},
+	{"search", "登録済みの書類を全文検索する", runSearch},
+	{"amendments", "書類の訂正の履歴と訂正された目次を出力する", runAmendments},
+	{"serve", "検索画面をHTTPで提供する", runServe},
+	{"migrate", "データベースのスキーマを更新する（up/down/status）", runMigrate},
+	{"archive", "書類のzipのアーカイブを検証する（verify）", runArchive},
+	{"fake-edinet", "フィクスチャを返すEDINET APIのサーバーを起動する（開発・テスト用）", runFakeEdinet},
+}
+
+// 引数を解釈してサブコマンドを実行し、終了コードを返す
+func run(args []string) int {
+	if len(args) == 0 {
+		usage(os.Stderr)
+		return exitUsage
+	}
+
+	name := args[0]
+	if name == "-h" || name == "--help" || name == "help" {
+		usage(os.Stdout)
+		return exitOK
+	}
+
+	for _, c := range commands {
+		if c.name == name {
+			return c.run(args[1:])
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "yakumo: 不明なコマンドです: %s\n\n", name)
+	usage(os.Stderr)
+	return exitUsage
+}
+
+// 使い方を出力する
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "使い方: yakumo <コマンド> [オプション]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "コマンド:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "各コマンドのオプションは yakumo <コマンド> -h で確認できます。")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "終了コード:")
+	fmt.Fprintf(w, "  %d  正常終了\n", exitOK)
+	fmt.Fprintf(w, "  %d  処理中のエラー、中断\n", exitError)
+	fmt.Fprintf(w, "  %d  引数の誤り\n", exitUsage)
+	fmt.Fprintf(w, "  %d  一部の書類の処理に失敗（sync、backfill、retry-failed。yakumo retry-failed で再処理できます）\n", exitPartial)
+}
+
+// サブコマンド用のFlagSetを作成する
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "使い方: yakumo %s [オプション] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// フラグを解釈する。解釈できなかった場合は終了コードを返す
+func parseFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK, false
+		}
+		return exitUsage, false
+	}
+	return exitOK, true
+}
+
+// 日付の文字列を解釈する
+func parseDate(s string) (time.Time, error) {
+	return time.ParseInLocation(dateLayout, s, time.Local)
+}
+
+// sync: 前回のチェックポイント以降（再確認期間を含む）と、指定日数の範囲で未処理の日付を処理する
+// チェックポイントがない場合は当日から遡って指定日数分を処理する
+func runSync(args []string) int {
+	fs := newFlagSet("sync", "")
+	dbf := addDBFlags(fs)
+	days := fs.Int("days", 365, "当日から遡って処理する日数（チェックポイントがある場合は、この範囲の未処理の日付を処理する）")
+	recheck := fs.Int("recheck", 7, "チェックポイントの日付から遡って再確認する日数")
+	full := fs.Bool("full", false, "チェックポイントを無視して -days 分をすべて処理する")
+	cfg := addPipelineFlags(fs)
+	filter := addFilterFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if *days < 1 {
+		fmt.Fprintln(os.Stderr, "yakumo sync: -days には1以上を指定してください")
+		return exitUsage
+	}
+	if *recheck < 0 {
+		fmt.Fprintln(os.Stderr, "yakumo sync: -recheck には0以上を指定してください")
+		return exitUsage
+	}
+	if !validPipelineConfig("sync", cfg) {
+		return exitUsage
+	}
+	if !filter.apply("sync", cfg) {
+		return exitUsage
+	}
+
+	s, ok := connectStore(dbf)
+	if !ok {
+		return exitError
+	}
+	defer s.Close()
+
+	// スキーマを確認して、未適用のマイグレーションを適用する
+	err := s.CreateSchema()
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+
+	to := time.Now()
+	from := to.AddDate(0, 0, -(*days - 1))
+	dates := datesBetween(from, to)
+	if !*full {
+		last, ok, err := s.LastSyncedDate()
+		if err != nil {
+			log.Print(err)
+			return exitError
+		}
+		if ok {
+			// チェックポイントの日付から再確認期間分を遡った日以降と、-days の範囲で未処理の日付を処理する
+			// （前回が途中で終了した場合に、古い日付が処理されないままにならないようにする）
+			synced, err := s.SyncedDates(from, to)
+			if err != nil {
+				log.Print(err)
+				return exitError
+			}
+			recheckFrom := last.AddDate(0, 0, -*recheck).Format(dateLayout)
+			dates = unsyncedDates(dates, synced, recheckFrom)
+			log.Printf("チェックポイント %s から再確認する日付と未処理の日付の %d日分を処理します（%s ～ %s）",
+				last.Format(dateLayout), len(dates), from.Format(dateLayout), to.Format(dateLayout))
+		}
+	}
+	return processDates(s, dates, *cfg)
+}
+
+// 期間内の日付を新しい日付から順に返す
+func datesBetween(from, to time.Time) []string {
+	dates := make([]string, 0)
+	first := from.Format(dateLayout)
+	for d := to; d.Format(dateLayout) >= first; d = d.AddDate(0, 0, -1) {
+		dates = append(dates, d.Format(dateLayout))
+	}
+	return dates
+}
+
+// dates のうち、recheckFrom 以降の日付と処理済みでない日付を返す
+func unsyncedDates(dates []string, synced []time.Time, recheckFrom string) []string {
+	done := make(map[string]bool)
+	for _, d := range synced {
+		done[d.Format(dateLayout)] = true
+	}
+	targets := make([]string, 0)
+	for _, d := range dates {
+		if d >= recheckFrom || !done[d] {
+			targets = append(targets, d)
+		}
+	}
+	return targets
+}
+
+// backfill: 指定した期間を処理する
+func runBackfill(args []string) int {
+	fs := newFlagSet("backfill", "")
+	dbf := addDBFlags(fs)
+	fromStr := fs.String("from", "", "処理を開始する日付（YYYY-MM-DD）")
+	toStr := fs.String("to", "", "処理を終了する日付（YYYY-MM-DD、省略時は当日）")
+	bulk := fs.Bool("bulk", false, "一括登録モード（全文検索インデックスを削除して登録し、最後に1回で作成し直す）")
+	cfg := addPipelineFlags(fs)
+	filter := addFilterFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	if *fromStr == "" {
+		fmt.Fprintln(os.Stderr, "yakumo backfill: -from を指定してください")
+		fs.Usage()
+		return exitUsage
+	}
+	from, err := parseDate(*fromStr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "yakumo backfill: -from の日付が不正です: %s\n", *fromStr)
+		return exitUsage
+	}
+	to := time.Now()
+	if *toStr != "" {
+		to, err = parseDate(*toStr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "yakumo backfill: -to の日付が不正です: %s\n", *toStr)
+			return exitUsage
+		}
+	}
+	if to.Before(from) {
+		fmt.Fprintln(os.Stderr, "yakumo backfill: -to には -from 以降の日付を指定してください")
+		return exitUsage
+	}
+	if !validPipelineConfig("backfill", cfg) {
+		return exitUsage
+	}
+	if !filter.apply("backfill", cfg) {
+		return exitUsage
+	}
+
+	s, ok := connectStore(dbf)
+	if !ok {
+		return exitError
+	}
+	defer s.Close()
+
+	// スキーマを確認して、未適用のマイグレーションを適用する
+	err = s.CreateSchema()
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+
+	if !*bulk {
+		return processRange(s, from, to, *cfg)
+	}
+
+	// 一括登録モード
+	// processRange はエラーや中断の場合も戻るので、インデックスは必ず作成し直す
+	// 強制終了してインデックスが作成されなかった場合は yakumo reindex で作成できる
+	log.Print("一括登録モード: 全文検索インデックスを削除します")
+	err = s.BeginBulkLoad()
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+	log.Print("一括登録モード: 強制終了した場合は、yakumo reindex で全文検索インデックスを作成してください")
+	code := processRange(s, from, to, *cfg)
+	log.Print("一括登録モード: 全文検索インデックスを作成します")
+	err = s.EndBulkLoad()
+	if err != nil {
+		log.Print(err)
+		log.Print("yakumo reindex で全文検索インデックスを作成してください")
+		return exitError
+	}
+	return code
+}
+
+// パイプラインのフラグを追加する
+func addPipelineFlags(fs *flag.FlagSet) *pipelineConfig {
+	cfg := defaultPipelineConfig
+	fs.IntVar(&cfg.downloadWorkers, "download-workers", cfg.downloadWorkers, "ダウンロードの並列数")
+	fs.IntVar(&cfg.extractWorkers, "extract-workers", cfg.extractWorkers, "テキスト抽出の並列数")
+	fs.Float64Var(&cfg.rateLimit, "rate", cfg.rateLimit, "EDINET APIへの1秒あたりの最大リクエスト数（リトライを含む。0は無制限）")
+	fs.IntVar(&cfg.retries, "retries", cfg.retries, "EDINET APIのリクエストが失敗した場合のリトライ回数")
+	fs.DurationVar(&cfg.requestTimeout, "request-timeout", cfg.requestTimeout, "EDINET APIの1回のリクエストのタイムアウト（0は無制限）")
+	fs.IntVar(&cfg.breakerThreshold, "breaker-threshold", cfg.breakerThreshold, "EDINET APIが停止しているとみなしてリクエストを一定時間止めるまでの連続失敗回数（0は止めない）")
+	fs.StringVar(&cfg.edinetURL, "edinet-url", defaultEdinetURL(), "EDINET APIのベースURL（省略時は環境変数 YAKUMO_EDINET_BASE_URL、または本番のAPI）")
+	fs.StringVar(&cfg.recordDir, "record", "", "EDINET APIのレスポンスを記録するディレクトリ")
+	fs.StringVar(&cfg.replayDir, "replay", "", "EDINET APIにアクセスせずに、このディレクトリに記録したレスポンスを使用する")
+	fs.StringVar(&cfg.archiveDir, "archive", os.Getenv("YAKUMO_ARCHIVE_DIR"), "ダウンロードしたzipを保存するアーカイブのディレクトリ（省略時は環境変数 YAKUMO_ARCHIVE_DIR）")
+	return &cfg
+}
+
+// 処理対象の書類種別のフラグ
+type filterFlags struct {
+	docTypes string
+	file     string
+}
+
+// 処理対象の書類種別のフラグを追加する
+func addFilterFlags(fs *flag.FlagSet) *filterFlags {
+	f := &filterFlags{}
+	fs.StringVar(&f.docTypes, "doc-types", "", "処理対象の書類種別コード（カンマ区切り。例: 120,130,140）")
+	fs.StringVar(&f.file, "filter", "", "処理対象の書類を判定するルールの設定ファイル（JSON）")
+	return f
+}
+
+// ルールを指定したか
+func (f *filterFlags) set() bool {
+	return f.docTypes != "" || f.file != ""
+}
+
+// フラグからルールを作成してパイプラインの設定に反映する
+func (f *filterFlags) apply(name string, cfg *pipelineConfig) bool {
+	var rules filterRules
+	var err error
+	switch {
+	case f.docTypes != "" && f.file != "":
+		fmt.Fprintf(os.Stderr, "yakumo %s: -doc-types と -filter は同時に指定できません\n", name)
+		return false
+	case f.docTypes != "":
+		rules, err = docTypeRules(f.docTypes)
+	case f.file != "":
+		rules, err = loadFilterRules(f.file)
+	default:
+		return true
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "yakumo %s: %v\n", name, err)
+		return false
+	}
+	cfg.filter = rules
+	return true
+}
+
+// パイプラインのフラグを検証する
+func validPipelineConfig(name string, cfg *pipelineConfig) bool {
+	if cfg.downloadWorkers < 1 || cfg.extractWorkers < 1 {
+		fmt.Fprintf(os.Stderr, "yakumo %s: -download-workers と -extract-workers には1以上を指定してください\n", name)
+		return false
+	}
+	if cfg.retries < 0 || cfg.requestTimeout < 0 || cfg.breakerThreshold < 0 {
+		fmt.Fprintf(os.Stderr, "yakumo %s: -retries、-request-timeout と -breaker-threshold には0以上を指定してください\n", name)
+		return false
+	}
+	if cfg.recordDir != "" && cfg.replayDir != "" {
+		fmt.Fprintf(os.Stderr, "yakumo %s: -record と -replay は同時に指定できません\n", name)
+		return false
+	}
+	return true
+}
+
+// パイプラインの設定に合わせてEDINET APIのクライアントを作成する
+func setupEdinetClient(cfg pipelineConfig) (*edinet.Client, bool) {
+	if cfg.replayDir != "" {
+		return setupReplayClient(cfg)
+	}
+
+	key, err := loadAPIKey()
+	if err != nil {
+		log.Print(err)
+		return nil, false
+	}
+	if key == "" {
+		log.Print(apiErrorMessage(edinet.ErrAPIKey))
+		return nil, false
+	}
+	c := newEdinetClient()
+	c.APIKey = key
+	c.BaseURL = strings.TrimSuffix(cfg.edinetURL, "/")
+
+	c.Limiter = edinet.NewRateLimiter(cfg.rateLimit)
+	c.Retry.MaxAttempts = cfg.retries + 1
+	c.Retry.RequestTimeout = cfg.requestTimeout
+	c.Breaker = &edinet.CircuitBreaker{Threshold: cfg.breakerThreshold, Cooldown: edinet.DefaultBreakerCooldown}
+
+	if cfg.recordDir != "" {
+		t, err := newRecordTransport(cfg.recordDir)
+		if err != nil {
+			log.Print(err)
+			return nil, false
+		}
+		c.HTTPClient = &http.Client{Transport: t}
+		log.Printf("EDINET APIのレスポンスを %s に記録します", cfg.recordDir)
+	}
+	return c, true
+}
+
+// 記録したレスポンスを再生するEDINET APIのクライアントを作成する
+// APIにはアクセスしないので、APIキーは不要でリクエスト間隔も制限しない
+func setupReplayClient(cfg pipelineConfig) (*edinet.Client, bool) {
+	t, err := newReplayTransport(cfg.replayDir)
+	if err != nil {
+		log.Print(err)
+		return nil, false
+	}
+	c := newEdinetClient()
+	c.APIKey = "replay"
+	c.HTTPClient = &http.Client{Transport: t}
+	// 再生の結果は何度リクエストしても変わらないので、リトライとサーキットブレーカーは使わない
+	c.Retry.MaxAttempts = 1
+	c.Retry.RequestTimeout = cfg.requestTimeout
+	c.Breaker = nil
+	c.Limiter = nil
+	log.Printf("EDINET APIの代わりに %s に記録したレスポンスを使用します", cfg.replayDir)
+	return c, true
+}
+
+// 中断のシグナル（Ctrl-C、SIGTERM）を受信したらキャンセルされる context を作成する
+// キャンセル後は通常の処理に戻すので、もう一度シグナルを送ると強制終了する
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sig:
+			log.Print("中断します。処理中の書類を片付けてから終了します（もう一度押すと強制終了します）")
+			signal.Stop(sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(sig)
+		cancel()
+	}
+}
+
+// 期間内の各日を新しい日付から順に処理する
+func processRange(s pipelineStore, from, to time.Time, cfg pipelineConfig) int {
+	return processDates(s, datesBetween(from, to), cfg)
+}
+
+// 日付（新しい順）を順に処理する
+// 中断した場合は、完了した日数と未処理の日付を出力する
+// （未処理の日付はチェックポイントを記録しないので、-days の範囲内なら次回の sync で処理される。backfill でも処理できる）
+func processDates(s pipelineStore, dates []string, cfg pipelineConfig) int {
+	p, ok := newPipeline(s, cfg)
+	if !ok {
+		return exitError
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+
+	var total pipelineResult
+	skipped := make([]string, 0) // 書類一覧を取得できなかった日付
+	for i, date := range dates {
+		res, err := p.exexOneDay(ctx, date)
+		total.add(res)
+
+		var le *listError
+		switch {
+		case ctx.Err() != nil:
+			log.Printf("中断しました: 完了 %d日、保存 %d件、失敗 %d件、未処理 %d件", i-len(skipped), total.saved, total.failed, total.interrupted)
+			printUnprocessedDates(append(skipped, dates[i:]...))
+			return exitError
+		case errors.As(err, &le):
+			// APIが停止している場合は、サーキットブレーカーにより次の日付のリクエストが待たされる
+			log.Print(err)
+			log.Printf("%s の書類一覧を取得できなかったため、次の日付の処理を続けます", date)
+			skipped = append(skipped, date)
+		case err != nil:
+			log.Print(err)
+			log.Printf("処理を中止しました: 完了 %d日、保存 %d件、失敗 %d件", i-len(skipped), total.saved, total.failed)
+			printUnprocessedDates(append(skipped, dates[i:]...))
+			return exitError
+		}
+	}
+	log.Printf("処理の結果: %d日、保存 %d件、失敗 %d件", len(dates)-len(skipped), total.saved, total.failed)
+	if len(skipped) > 0 {
+		printUnprocessedDates(skipped)
+		return exitError
+	}
+	if total.failed > 0 {
+		return exitPartial
+	}
+	return exitOK
+}
+
+// 未処理の日付（新しい順）と、その処理方法を出力する
+// 未処理の日付はチェックポイントを記録していないので、-days の範囲内なら次回の sync で処理される
+func printUnprocessedDates(dates []string) {
+	oldest, newest := dates[0], dates[0]
+	for _, d := range dates {
+		if d < oldest {
+			oldest = d
+		}
+		if d > newest {
+			newest = d
+		}
+	}
+	log.Printf("未処理の %d日（%s ～ %s）は、次回の yakumo sync（-days の範囲内の場合）または yakumo backfill -from %s -to %s で処理できます",
+		len(dates), oldest, newest, oldest, newest)
+}
+
+// retry-failed: failed_documents に記録された書類を再処理する
+func runRetryFailed(args []string) int {
+	fs := newFlagSet("retry-failed", "")
+	dbf := addDBFlags(fs)
+	maxAttempts := fs.Int("max-attempts", 5, "試行回数がこの値に達した書類は再処理しない")
+	list := fs.Bool("list", false, "再処理せずに失敗した書類の一覧を出力する")
+	cfg := addPipelineFlags(fs)
+	filter := addFilterFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if *maxAttempts < 1 {
+		fmt.Fprintln(os.Stderr, "yakumo retry-failed: -max-attempts には1以上を指定してください")
+		return exitUsage
+	}
+	if !validPipelineConfig("retry-failed", cfg) {
+		return exitUsage
+	}
+	if !filter.apply("retry-failed", cfg) {
+		return exitUsage
+	}
+
+	s, ok := connectStore(dbf)
+	if !ok {
+		return exitError
+	}
+	defer s.Close()
+
+	err := s.CreateSchema()
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+
+	failed, err := s.FailedDocuments()
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+
+	if *list {
+		for _, f := range failed {
+			fmt.Printf("%s %s %-8s 試行%d回 %s %s\n", f.Date.Format(dateLayout), f.DocID, f.Stage, f.Attempts,
+				f.LastAttemptAt.Format("2006-01-02 15:04:05"), f.Error)
+		}
+		return exitOK
+	}
+
+	// 日付ごとにまとめて再処理する
+	var dates []string
+	targets := make(map[string][]edinet.Result)
+	skipped := 0
+	for _, f := range failed {
+		date := f.Date.Format(dateLayout)
+		if f.Attempts >= *maxAttempts {
+			log.Printf("%s %s は試行回数が上限（%d回）に達しているため再処理しません: %s", date, f.DocID, f.Attempts, f.Error)
+			skipped++
+			continue
+		}
+		if _, ok := targets[date]; !ok {
+			dates = append(dates, date)
+		}
+		targets[date] = append(targets[date], f.Result)
+	}
+
+	if len(dates) == 0 {
+		log.Print("再処理する書類はありません")
+		return exitOK
+	}
+	p, ok := newPipeline(s, *cfg)
+	if !ok {
+		return exitError
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+
+	var total pipelineResult
+	cleared := 0  // 再処理の対象外になったため削除した書類数
+	unlisted := 0 // 書類一覧を取得できなかったため再処理しなかった書類数
+	for _, date := range dates {
+		if ctx.Err() != nil {
+			total.interrupted += len(targets[date])
+			continue
+		}
+		results, n, err := p.recheckFailures(ctx, date, targets[date], filter.set())
+		cleared += n
+		var le *listError
+		switch {
+		case ctx.Err() != nil:
+			total.interrupted += len(targets[date])
+			continue
+		case errors.As(err, &le):
+			log.Print(err)
+			unlisted += len(targets[date])
+			continue
+		case err != nil:
+			log.Print(err)
+			return exitError
+		}
+
+		res, err := p.processDocuments(ctx, date, results)
+		total.add(res)
+		if err != nil {
+			log.Print(err)
+			log.Printf("処理を中止しました: 成功 %d件、失敗 %d件（もう一度 yakumo retry-failed を実行してください）", total.saved, total.failed)
+			return exitError
+		}
+	}
+	log.Printf("再処理の結果: 成功 %d件、失敗 %d件、対象外 %d件、上限到達 %d件", total.saved, total.failed, cleared, skipped)
+	if total.interrupted > 0 || unlisted > 0 {
+		log.Printf("中断した、または書類一覧を取得できなかったため %d件を再処理していません（もう一度 yakumo retry-failed を実行してください）",
+			total.interrupted+unlisted)
+		return exitError
+	}
+
+	if total.failed > 0 {
+		return exitPartial
+	}
+	return exitOK
+}
+
+// 失敗した書類の最新の状態を、書類一覧APIで確認する
+// 失敗した後に取り下げられた書類、不開示になった書類、（checkFilter の場合）処理対象のルールに一致しなくなった書類は
+// 保存すると検索結果に表示されてしまうので、再処理せずに failed_documents から削除する。
+// 再処理する書類（書類一覧の最新の値）と、削除した書類数を返す。書類一覧を取得できなかった場合は *listError を返す
+func (p *pipeline) recheckFailures(ctx context.Context, date string, failed []edinet.Result, checkFilter bool) ([]edinet.Result, int, error) {
+	docs, err := GetDocuments(ctx, p.client, date)
+	if err != nil {
+		return nil, 0, &listError{date: date, err: err}
+	}
+	current := make(map[string]edinet.Result)
+	for _, r := range docs.Results {
+		current[r.DocID] = r
+	}
+
+	results := make([]edinet.Result, 0, len(failed))
+	cleared := 0
+	for _, r := range failed {
+		if c, ok := current[r.DocID]; ok {
+			r = c
+		}
+		if statusOf(&r).hidden() || (checkFilter && !p.cfg.filter.match(&r)) {
+			log.Printf("%s %s は取り下げられた、不開示になった、または処理対象ではなくなったため再処理しません", date, r.DocID)
+			_, err = p.store.ClearFailure(r.DocID)
+			if err != nil {
+				return nil, cleared, fmt.Errorf("failed_documents の削除に失敗: %w", err)
+			}
+			cleared++
+			continue
+		}
+		results = append(results, r)
+	}
+	return results, cleared, nil
+}
+
+// reindex: 全文検索インデックスを再構築する
+func runReindex(args []string) int {
+	fs := newFlagSet("reindex", "")
+	dbf := addDBFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	s, ok := connectStore(dbf)
+	if !ok {
+		return exitError
+	}
+	defer s.Close()
+
+	err := s.CreateSchema()
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+
+	log.Print("インデックスを再構築します")
+	err = s.Reindex()
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+	log.Print("インデックスを再構築しました")
+	return exitOK
+}
+
+// search: 全文検索してテキストで出力する
+func runSearch(args []string) int {
+	fs := newFlagSet("search", "<検索キーワード>")
+	dbf := addDBFlags(fs)
+	breadcrumb := fs.String("b", "", "目次で絞り込むキーワード")
+	docTypes := fs.String("doc-types", "", "書類種別コードで絞り込む（カンマ区切り。例: 120,140）")
+	allVersions := fs.Bool("all-versions", false, "訂正報告書で訂正された目次（訂正前の目次）も出力する")
+	fromStr := fs.String("from", "", "提出日がこの日以降の書類に絞り込む（YYYY-MM-DD）")
+	toStr := fs.String("to", "", "提出日がこの日以前の書類に絞り込む（YYYY-MM-DD）")
+	sortOrder := fs.String("sort", "new", "提出日時の並び順（new: 新しい順、old: 古い順）")
+	limit := fs.Int("limit", 20, "出力する最大件数（0は無制限）")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	opts := searchOptions{
+		Query:       strings.Join(fs.Args(), " "),
+		Breadcrumb:  *breadcrumb,
+		DocTypes:    splitCodes(*docTypes),
+		AllVersions: *allVersions,
+		Limit:       *limit,
+	}
+	var err error
+	if *fromStr != "" {
+		if opts.From, err = parseDate(*fromStr); err != nil {
+			log.Printf("-from の日付が不正です: %v", err)
+			return exitUsage
+		}
+	}
+	if *toStr != "" {
+		if opts.To, err = parseDate(*toStr); err != nil {
+			log.Printf("-to の日付が不正です: %v", err)
+			return exitUsage
+		}
+	}
+	switch *sortOrder {
+	case "new":
+	case "old":
+		opts.Oldest = true
+	default:
+		log.Printf("-sort には new か old を指定してください: %s", *sortOrder)
+		return exitUsage
+	}
+	s, ok := connectStore(dbf)
+	if !ok {
+		return exitError
+	}
+	defer s.Close()
+
+	err = s.CheckSchema()
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+
+	hits, err := s.Search(opts)
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+
+	if len(hits) == 0 {
+		fmt.Println("一致する結果がありませんでした")
+		return exitOK
+	}
+
+	prevDocID := ""
+	for _, h := range hits {
+		if h.DocID != prevDocID {
+			fmt.Printf("\n%s %s／%s／%s\n", h.DocID, h.FilerName, h.DocDescription, formatDateTime(h.SubmitDateTime))
+			if h.Amended() {
+				fmt.Printf("  ※訂正報告書が提出されています（最新: %s、履歴: yakumo amendments %s）\n", h.LatestDocID, h.DocID)
+			}
+			prevDocID = h.DocID
+		}
+		fmt.Printf("  %s\n", h.Breadcrumb)
+		fmt.Printf("    %s\n", snippetToText(h.Snippet))
+	}
+	return exitOK
+}
+
+// amendments: 書類の訂正の履歴を出力する
+func runAmendments(args []string) int {
+	fs := newFlagSet("amendments", "<docID>")
+	dbf := addDBFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	s, ok := connectStore(dbf)
+	if !ok {
+		return exitError
+	}
+	defer s.Close()
+
+	err := s.CheckSchema()
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+
+	chain, err := s.AmendmentChain(fs.Arg(0))
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+	if len(chain) == 0 {
+		fmt.Fprintf(os.Stderr, "yakumo amendments: 書類が見つかりません: %s\n", fs.Arg(0))
+		return exitError
+	}
+
+	for i, c := range chain {
+		fmt.Printf("%d. %s %s／%s／%s\n", i+1, c.DocID, c.FilerName, c.DocDescription, formatDateTime(c.SubmitDateTime))
+		if i == 0 {
+			continue
+		}
+		if len(c.Corrected) == 0 {
+			fmt.Println("   訂正された目次: なし（訂正箇所は本文を参照）")
+			continue
+		}
+		fmt.Println("   訂正された目次:")
+		for _, b := range c.Corrected {
+			fmt.Printf("     %s\n", b)
+		}
+	}
+	return exitOK
+}
+
+// カンマ区切りのコードを分割する。空の要素は除く
+func splitCodes(s string) []string {
+	codes := make([]string, 0)
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		if c != "" {
+			codes = append(codes, c)
+		}
+	}
+	return codes
+}
+
+// migrate: データベースのスキーマを更新する
+func runMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "使い方: yakumo migrate up|down|status [オプション]")
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "up":
+		fs := newFlagSet("migrate up", "")
+		dbf := addDBFlags(fs)
+		to := fs.Int("to", 0, "このバージョンまで適用する（0はすべて）")
+		if code, ok := parseFlags(fs, args[1:]); !ok {
+			return code
+		}
+		s, ok := connectStore(dbf)
+		if !ok {
+			return exitError
+		}
+		defer s.Close()
+
+		count, err := s.MigrateUp(*to)
+		if err != nil {
+			log.Print(err)
+			return exitError
+		}
+		log.Printf("%d件のマイグレーションを適用しました", count)
+
+	case "down":
+		fs := newFlagSet("migrate down", "")
+		dbf := addDBFlags(fs)
+		steps := fs.Int("steps", 1, "取り消すマイグレーションの数")
+		if code, ok := parseFlags(fs, args[1:]); !ok {
+			return code
+		}
+		if *steps < 1 {
+			fmt.Fprintln(os.Stderr, "yakumo migrate down: -steps には1以上を指定してください")
+			return exitUsage
+		}
+		s, ok := connectStore(dbf)
+		if !ok {
+			return exitError
+		}
+		defer s.Close()
+
+		count, err := s.MigrateDown(*steps)
+		if err != nil {
+			log.Print(err)
+			return exitError
+		}
+		log.Printf("%d件のマイグレーションを取り消しました", count)
+
+	case "status":
+		fs := newFlagSet("migrate status", "")
+		dbf := addDBFlags(fs)
+		if code, ok := parseFlags(fs, args[1:]); !ok {
+			return code
+		}
+		s, ok := connectStore(dbf)
+		if !ok {
+			return exitError
+		}
+		defer s.Close()
+
+		states, err := s.MigrationStatus()
+		if err != nil {
+			log.Print(err)
+			return exitError
+		}
+		for _, st := range states {
+			status := "未適用"
+			if st.applied {
+				status = "適用済み " + st.appliedAt.Format("2006-01-02 15:04:05")
+			}
+			if st.unknown {
+				status += "（このプログラムにないマイグレーション）"
+			}
+			fmt.Printf("%04d %-20s %s\n", st.version, st.name, status)
+		}
+
+	default:
+		fmt.Fprintf(os.Stderr, "yakumo migrate: 不明なサブコマンドです: %s（up、down、status）\n", args[0])
+		return exitUsage
+	}
+	return exitOK
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"yakumo/edinet"
+)
+
+// testdata の 2024-06-27 の書類一覧を、replacer で書き換えたフィクスチャのディレクトリを作成する
+func writeTestFixtures(t *testing.T, replacer *strings.Replacer) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range []string{"documents/2024-06-27.json", "zip/S100TEST.zip"} {
+		b, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(name, ".json") {
+			b = []byte(replacer.Replace(string(b)))
+		}
+		err = os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(dir, name), b, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// testdata の 2024-06-27 の書類一覧の S100TEST
+func testResult(t *testing.T) edinet.Result {
+	t.Helper()
+	b, err := os.ReadFile("testdata/documents/2024-06-27.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var docs edinet.Documents
+	err = json.Unmarshal(b, &docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return docs.Results[0]
+}
+
+func TestRetryFailedRechecksStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		replacer  *strings.Replacer
+		wantSaved bool
+	}{
+		{"変更なし", strings.NewReplacer(), true},
+		{"取り下げられた", strings.NewReplacer(`"withdrawalStatus": "0"`, `"withdrawalStatus": "2"`), false},
+		{"不開示になった", strings.NewReplacer(`"disclosureStatus": "0"`, `"disclosureStatus": "1"`), false},
+		{"処理対象ではなくなった", strings.NewReplacer(`"docTypeCode": "120"`, `"docTypeCode": "140"`), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestEnv(t)
+
+			f, err := newFakeEdinet(writeTestFixtures(t, tt.replacer), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			srv := httptest.NewServer(f)
+			defer srv.Close()
+
+			// 失敗したときの（古い）書類一覧の値で failed_documents に記録しておく
+			dsn := "sqlite://" + filepath.Join(t.TempDir(), "yakumo.db")
+			s := openTestStore(t, dsn)
+			err = s.CreateSchema()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = s.RecordFailure("2024-06-27", testResult(t), stageDownload, errors.New("テスト"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			code := run([]string{"retry-failed", "-db", dsn, "-edinet-url", srv.URL + "/api/v2", "-rate", "0", "-doc-types", "120,130"})
+			if code != exitOK {
+				t.Fatalf("終了コード = %d, want %d", code, exitOK)
+			}
+
+			doc, err := s.FindDocument("S100TEST")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (doc != nil) != tt.wantSaved {
+				t.Errorf("保存 = %v, want %v", doc != nil, tt.wantSaved)
+			}
+			failed, err := s.FailedDocuments()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(failed) != 0 {
+				t.Errorf("failed_documents = %d件, want 0件", len(failed))
+			}
+		})
+	}
+}
+
+func TestBackfillPartialFailure(t *testing.T) {
+	setTestEnv(t)
+
+	// 書類のzipを取得できない（リトライしない404）
+	dir := writeTestFixtures(t, strings.NewReplacer())
+	err := os.WriteFile(filepath.Join(dir, "errors.json"), []byte(`{"S100TEST": 404}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := newFakeEdinet(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	dsn := "sqlite://" + filepath.Join(t.TempDir(), "yakumo.db")
+	args := []string{"-db", dsn, "-edinet-url", srv.URL + "/api/v2", "-rate", "0"}
+	code := run(append([]string{"backfill", "-from", "2024-06-27", "-to", "2024-06-27"}, args...))
+	if code != exitPartial {
+		t.Errorf("backfill の終了コード = %d, want %d", code, exitPartial)
+	}
+	code = run(append([]string{"retry-failed"}, args...))
+	if code != exitPartial {
+		t.Errorf("retry-failed の終了コード = %d, want %d", code, exitPartial)
+	}
+}
+
+func TestDatesBetween(t *testing.T) {
+	date := func(s string) time.Time {
+		d, err := parseDate(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	tests := []struct {
+		name     string
+		from, to string
+		want     []string
+	}{
+		{"1日", "2024-06-27", "2024-06-27", []string{"2024-06-27"}},
+		{"新しい日付から順に", "2024-06-26", "2024-06-28", []string{"2024-06-28", "2024-06-27", "2024-06-26"}},
+		{"月と年をまたぐ", "2023-12-31", "2024-01-01", []string{"2024-01-01", "2023-12-31"}},
+		{"うるう日", "2024-02-28", "2024-03-01", []string{"2024-03-01", "2024-02-29", "2024-02-28"}},
+		{"from が to より後", "2024-06-28", "2024-06-27", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := datesBetween(date(tt.from), date(tt.to))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("datesBetween = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// 時刻を含む場合も日付単位で数える
+	got := datesBetween(date("2024-06-26").Add(23*time.Hour), date("2024-06-27").Add(time.Hour))
+	if want := []string{"2024-06-27", "2024-06-26"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("datesBetween（時刻を含む） = %q, want %q", got, want)
+	}
+}
+
+func TestUnsyncedDates(t *testing.T) {
+	dates := []string{"2024-06-30", "2024-06-29", "2024-06-28", "2024-06-27", "2024-06-26"}
+	synced := func(ss ...string) []time.Time {
+		ds := make([]time.Time, 0, len(ss))
+		for _, s := range ss {
+			d, err := time.ParseInLocation(dateLayout, s, jst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ds = append(ds, d)
+		}
+		return ds
+	}
+	tests := []struct {
+		name        string
+		synced      []time.Time
+		recheckFrom string
+		want        []string
+	}{
+		{"処理済みの日付なし", synced(), "2024-06-29", dates},
+		{"すべて処理済みなら再確認期間だけ", synced(dates...), "2024-06-29", []string{"2024-06-30", "2024-06-29"}},
+		{"再確認期間より前の未処理の日付", synced("2024-06-30", "2024-06-29", "2024-06-28", "2024-06-26"), "2024-06-30",
+			[]string{"2024-06-30", "2024-06-27"}},
+		{"範囲外の処理済みの日付は無視する", synced("2024-06-25", "2024-07-01"), "2024-07-01", dates},
+		{"再確認期間が範囲より後", synced(dates...), "2024-07-08", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := unsyncedDates(dates, tt.synced, tt.recheckFrom)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unsyncedDates = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
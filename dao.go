@@ -1,250 +1,969 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
-	_ "github.com/lib/pq"
+	"yakumo/edinet"
+	"yakumo/extractor"
+
+	"github.com/lib/pq"
 )
 
-// ドライバー名
+// PostgreSQL（PGroonga）のドライバー名
 const dbDriver string = "postgres"
 
-// データソース：DockerのPostgreSQLへの接続情報
-// デフォルトのDockerコンテナを使わない場合は修正
-var dbSource string = "user=PGroonga password=PGroonga dbname=PGroonga sslmode=disable"
+// database/sql を使用する Store の共通部分
+// 1つの *sql.DB（コネクションプール）をコマンドの終了まで使い回す
+// SQLは PostgreSQL と SQLite の両方で使える書き方にする（全文検索は各データベースの実装で行う）
+type sqlStore struct {
+	db           *sql.DB
+	migrationDir string // マイグレーションのディレクトリ
+	copyIn       bool   // document_texts の登録に COPY を使う（PostgreSQL）
+}
 
-// テーブルとインデックスを作成する。
-// すでに存在する場合はそのまま。（エラーにもしない）
-func createTableAndIndex() error {
+// PostgreSQL（PGroonga）を使用する Store
+type pgStore struct {
+	sqlStore
+}
 
-	db, err := sql.Open(dbDriver, dbSource)
+// PostgreSQLに接続する
+func openPostgres(cfg dbConfig) (*pgStore, error) {
+	db, err := sql.Open(dbDriver, cfg.dsn)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer db.Close()
-
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS documents (
-			date char(10) NOT NULL,
-			seqNumber int NOT NULL,
-			docID char(8) NOT NULL,
-			submitDateTime char(16) NULL,
-			edinetCode char(6) NULL,
-			secCode char(5) NULL,
-			filerName text NULL,
-			periodStart  char(10) NULL,
-			periodEnd char(10) NULL,
-			docDescription text NULL,
-			PRIMARY KEY (date, seqNumber)
-		);
-
-		CREATE TABLE IF NOT EXISTS document_texts (
-			docID char(8) NOT NULL,
-			seq int NOT NULL,
-			title text NOT NULL,
-			breadcrumb text NOT NULL,
-			content text NOT NULL,
-			PRIMARY KEY (docID, seq)
-		);
-
-		CREATE EXTENSION IF NOT EXISTS pgroonga;
-		CREATE INDEX IF NOT EXISTS pgroonga_content_index ON document_texts USING pgroonga (breadcrumb, content);
-		`)
+	db.SetMaxOpenConns(cfg.maxOpenConns)
+	db.SetMaxIdleConns(cfg.maxIdleConns)
+	db.SetConnMaxLifetime(cfg.connMaxLifetime)
+
+	err = db.Ping()
 	if err != nil {
-		return err
+		db.Close()
+		return nil, err
 	}
-	return nil
+	return &pgStore{sqlStore{db: db, migrationDir: "migrations", copyIn: true}}, nil
+}
+
+// 接続を閉じる
+func (s *sqlStore) Close() error {
+	return s.db.Close()
 }
 
 // データベースに登録済みかをチェックする
-func exists(date string, result Result) (bool, error) {
-	db, err := sql.Open(dbDriver, dbSource)
-	if err != nil {
+func (s *sqlStore) Exists(doc *Document) (bool, error) {
+	// 同一キーのレコードがあり、書類一覧の内容に変更なければtrue（存在する）
+	stored, err := loadDocument(s.db, doc.Date, doc.SeqNumber)
+	if err != nil || stored == nil {
 		return false, err
 	}
-	defer db.Close()
+	return stored.sameListing(doc), nil
+}
+
+// docIDを指定して、登録済みの書類（書類一覧の日付が最新のもの）を取得する。なければ nil を返す
+func (s *sqlStore) FindDocument(docID string) (*Document, error) {
+	row := s.db.QueryRow(fmt.Sprintf(`
+		SELECT %s, date, seqNumber
+		FROM documents
+		WHERE docID = $1
+		ORDER BY date DESC, seqNumber DESC
+		LIMIT 1
+		`, strings.Join(documentColumns, ",")), docID)
+	d, err := scanDocument(row.Scan, len(documentColumns))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return d, err
+}
+
+// import で登録する書類の連番を返す
+// 書類一覧APIの連番（1から）と重ならないよう、その日の -1, -2, ... を順に割り当てる
+func (s *sqlStore) NextImportSeqNumber(date time.Time) (int, error) {
+	var seq int
+	err := s.db.QueryRow(`
+		SELECT COALESCE(MIN(seqNumber), 0) - 1
+		FROM documents
+		WHERE date = $1 AND seqNumber < 0
+		`, date.Format(dateLayout)).Scan(&seq)
+	return seq, err
+}
 
-	// documentsテーブルの存在チェック
-	rows, err := db.Query(`
-		SELECT submitDateTime,edinetCode,secCode,filerName,periodStart,periodEnd,docDescription
-		FROM documents 
+// クエリを実行できるもの（*sql.DB、*sql.Tx）
+type querier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// 日付と連番を指定して、登録済みの書類を取得する。なければ nil を返す
+func loadDocument(q querier, date time.Time, seqNumber int) (*Document, error) {
+	n := len(documentColumns)
+	row := q.QueryRow(fmt.Sprintf(`
+		SELECT %s, date, seqNumber
+		FROM documents
 		WHERE date = $1 AND seqNumber = $2
-		`, date, result.SeqNumber)
-	if err != nil {
-		return false, err
+		`, strings.Join(documentColumns, ",")), date.Format(dateLayout), seqNumber)
+	d, err := scanDocument(row.Scan, n)
+	if err == sql.ErrNoRows {
+		return nil, nil
 	}
-	defer rows.Close()
-	if rows.Next() {
-		// データがあり変更なければtrue（存在する）
-		var submitDateTime string
-		var edinetCode string
-		var secCode string
-		var filerName string
-		var periodStart string
-		var periodEnd string
-		var docDescription string
-		err = rows.Scan(&submitDateTime, &edinetCode, &secCode, &filerName, &periodStart, &periodEnd, &docDescription)
-		if err != nil {
-			return false, err
-		}
+	return d, err
+}
 
-		if submitDateTime == result.SubmitDateTime &&
-			edinetCode == result.EdinetCode &&
-			strings.Trim(secCode, " ") == result.SecCode &&
-			filerName == result.FilerName &&
-			periodStart == result.PeriodStart &&
-			periodEnd == result.PeriodEnd &&
-			docDescription == result.DocDescription {
-			return true, nil
-		}
-		fmt.Printf("[%s] [%s]\n", secCode, result.SecCode)
+// documentColumns、date、seqNumber の順の列を Document に読み込む
+// NULLの列は空文字列、ゼロ値、false にする
+func scanDocument(scan func(dest ...any) error, n int) (*Document, error) {
+	var (
+		docID, edinetCode, secCode, jcn, filerName, fundCode               sql.NullString
+		ordinanceCode, formCode, docTypeCode, docDescription               sql.NullString
+		issuerEdinetCode, subjectEdinetCode, subsidiaryEdinetCode          sql.NullString
+		currentReportReason, parentDocID                                   sql.NullString
+		withdrawalStatus, docInfoEditStatus, disclosureStatus, legalStatus sql.NullString
+		periodStart, periodEnd, submitDateTime, opeDateTime, date          sql.NullTime
+		xbrlFlag, pdfFlag, attachDocFlag, englishDocFlag, csvFlag          sql.NullBool
+		seqNumber                                                          int
+	)
+	dest := []any{
+		&docID, &edinetCode, &secCode, &jcn, &filerName, &fundCode,
+		&ordinanceCode, &formCode, &docTypeCode, &periodStart, &periodEnd,
+		&submitDateTime, &docDescription, &issuerEdinetCode, &subjectEdinetCode,
+		&subsidiaryEdinetCode, &currentReportReason, &parentDocID, &opeDateTime,
+		&withdrawalStatus, &docInfoEditStatus, &disclosureStatus,
+		&xbrlFlag, &pdfFlag, &attachDocFlag, &englishDocFlag, &csvFlag, &legalStatus,
+		&date, &seqNumber,
 	}
-	return false, nil
+	if len(dest) != n+2 {
+		return nil, fmt.Errorf("documents テーブルの列数が一致しません: %d", n)
+	}
+	if err := scan(dest...); err != nil {
+		return nil, err
+	}
+	return &Document{
+		Date:                 dateInJST(date),
+		SeqNumber:            seqNumber,
+		DocID:                docID.String,
+		EdinetCode:           edinetCode.String,
+		SecCode:              secCode.String,
+		Jcn:                  jcn.String,
+		FilerName:            filerName.String,
+		FundCode:             fundCode.String,
+		OrdinanceCode:        ordinanceCode.String,
+		FormCode:             formCode.String,
+		DocTypeCode:          docTypeCode.String,
+		PeriodStart:          dateInJST(periodStart),
+		PeriodEnd:            dateInJST(periodEnd),
+		SubmitDateTime:       inJST(submitDateTime),
+		DocDescription:       docDescription.String,
+		IssuerEdinetCode:     issuerEdinetCode.String,
+		SubjectEdinetCode:    subjectEdinetCode.String,
+		SubsidiaryEdinetCode: subsidiaryEdinetCode.String,
+		CurrentReportReason:  currentReportReason.String,
+		ParentDocID:          parentDocID.String,
+		OpeDateTime:          inJST(opeDateTime),
+		WithdrawalStatus:     withdrawalStatus.String,
+		DocInfoEditStatus:    docInfoEditStatus.String,
+		DisclosureStatus:     disclosureStatus.String,
+		XbrlFlag:             xbrlFlag.Bool,
+		PdfFlag:              pdfFlag.Bool,
+		AttachDocFlag:        attachDocFlag.Bool,
+		EnglishDocFlag:       englishDocFlag.Bool,
+		CsvFlag:              csvFlag.Bool,
+		LegalStatus:          legalStatus.String,
+	}, nil
 }
 
-// データベースに保存する
-func save(date string, result Result) error {
+// NULLの場合はゼロ値、それ以外は日本時間にする
+func inJST(t sql.NullTime) time.Time {
+	if !t.Valid {
+		return time.Time{}
+	}
+	return t.Time.In(jst)
+}
 
-	db, err := sql.Open(dbDriver, dbSource)
-	if err != nil {
-		return err
+// date 型の列の値を日本時間の0時にする。NULLの場合はゼロ値
+func dateInJST(t sql.NullTime) time.Time {
+	if !t.Valid {
+		return time.Time{}
 	}
-	defer db.Close()
+	y, m, d := t.Time.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, jst)
+}
+
+// documents テーブルの列（date、seqNumber 以外）
+// 書類一覧APIの結果の全項目を保存する
+var documentColumns = []string{
+	"docID", "edinetCode", "secCode", "jcn", "filerName", "fundCode",
+	"ordinanceCode", "formCode", "docTypeCode", "periodStart", "periodEnd",
+	"submitDateTime", "docDescription", "issuerEdinetCode", "subjectEdinetCode",
+	"subsidiaryEdinetCode", "currentReportReason", "parentDocID", "opeDateTime",
+	"withdrawalStatus", "docInfoEditStatus", "disclosureStatus",
+	"xbrlFlag", "pdfFlag", "attachDocFlag", "englishDocFlag", "csvFlag", "legalStatus",
+}
 
-	tx, err := db.Begin()
+// documentColumns の順の値と、date、seqNumber を返す
+func documentValues(doc *Document) []any {
+	return []any{
+		doc.DocID, doc.EdinetCode, nullIfEmpty(doc.SecCode), nullIfEmpty(doc.Jcn),
+		doc.FilerName, nullIfEmpty(doc.FundCode),
+		nullIfEmpty(doc.OrdinanceCode), nullIfEmpty(doc.FormCode), doc.DocTypeCode,
+		nullDate(doc.PeriodStart), nullDate(doc.PeriodEnd),
+		nullTime(doc.SubmitDateTime), doc.DocDescription, nullIfEmpty(doc.IssuerEdinetCode),
+		nullIfEmpty(doc.SubjectEdinetCode),
+		nullIfEmpty(doc.SubsidiaryEdinetCode), nullIfEmpty(doc.CurrentReportReason),
+		nullIfEmpty(doc.ParentDocID), nullTime(doc.OpeDateTime),
+		doc.WithdrawalStatus, doc.DocInfoEditStatus, doc.DisclosureStatus,
+		doc.XbrlFlag, doc.PdfFlag, doc.AttachDocFlag,
+		doc.EnglishDocFlag, doc.CsvFlag, nullIfEmpty(doc.LegalStatus),
+		doc.Date.Format(dateLayout), doc.SeqNumber,
+	}
+}
+
+// 日付をパラメータにする。ゼロ値の場合はNULL
+// date 型の列に渡すため、タイムゾーンによらないよう文字列（YYYY-MM-DD）にする
+func nullDate(t time.Time) sql.NullString {
+	if t.IsZero() {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: t.Format(dateLayout), Valid: true}
+}
+
+// 日時をパラメータにする。ゼロ値の場合はNULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// documents テーブルにインサートするSQL（パラメータは documentValues の順）
+func insertDocumentSQL() string {
+	cols := append(append([]string{}, documentColumns...), "date", "seqNumber")
+	params := make([]string, len(cols))
+	for i := range cols {
+		params[i] = fmt.Sprintf("$%d", i+1)
+	}
+	return "INSERT INTO documents(" + strings.Join(cols, ",") + ") VALUES(" + strings.Join(params, ",") + ")"
+}
+
+// documents テーブルをアップデートするSQL（パラメータは documentValues の順）
+func updateDocumentSQL() string {
+	sets := make([]string, len(documentColumns))
+	for i, c := range documentColumns {
+		sets[i] = fmt.Sprintf("%s = $%d", c, i+1)
+	}
+	n := len(documentColumns)
+	return fmt.Sprintf("UPDATE documents SET %s WHERE date = $%d AND seqNumber = $%d", strings.Join(sets, ", "), n+1, n+2)
+}
+
+// 登録済みの書類のメタデータを書類一覧APIの最新の値で更新する
+// テキストの再作成が不要な項目（縦覧区分等）の変更や、列の追加前に登録した書類の補完に使用する
+func (s *sqlStore) UpdateDocumentMetadata(doc *Document) error {
+	_, err := s.db.Exec(updateDocumentSQL(), documentValues(doc)...)
+	return err
+}
+
+// 書類のメタデータと抽出したテキストをデータベースに保存する
+// ctx がキャンセルされた場合はロールバックする
+func (s *sqlStore) SaveDocument(ctx context.Context, doc *Document, parsed *extractor.ParsedDocument) error {
+
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		log.Print("トランザクション開始エラー")
 		return err
 	}
 
 	// documentsテーブルの更新
-	// 同一キーレコードがあった場合、そのレコードの値と比較して変更があればアップデートする。変更なければなにもしない。
-	// 同一キーレコードがなければインサートする
-	rows, err := tx.Query(`
-		SELECT submitDateTime,edinetCode,secCode,filerName,periodStart,periodEnd,docDescription
-		FROM documents 
-		WHERE date = $1 AND seqNumber = $2
-		`, date, result.SeqNumber)
+	// 同一キーレコードがあった場合、最新の値でアップデートする。同一キーレコードがなければインサートする
+	stored, err := loadDocument(tx, doc.Date, doc.SeqNumber)
 	if err != nil {
 		log.Print("documentsテーブル selectエラー")
 		tx.Rollback()
 		return err
 	}
 
-	if rows.Next() {
-		// データあり、変更あればupdate、なければなにもしない
-		var submitDateTime string
-		var edinetCode string
-		var secCode string
-		var filerName string
-		var periodStart string
-		var periodEnd string
-		var docDescription string
-		err = rows.Scan(&submitDateTime, &edinetCode, &secCode, &filerName, &periodStart, &periodEnd, &docDescription)
+	if stored != nil {
+		// データあり、update
+		if !stored.sameListing(doc) {
+			log.Print("UPDATE documents")
+		}
+		_, err = tx.Exec(updateDocumentSQL(), documentValues(doc)...)
 		if err != nil {
-			log.Print("documentsテーブル scanエラー")
+			log.Print("documentsテーブル 更新エラー")
 			tx.Rollback()
 			return err
 		}
-		rows.Close()
-
-		if submitDateTime == result.SubmitDateTime &&
-			edinetCode == result.EdinetCode &&
-			secCode == result.SecCode &&
-			filerName == result.FilerName &&
-			periodStart == result.PeriodStart &&
-			periodEnd == result.PeriodEnd &&
-			docDescription == result.DocDescription {
-			// 変更なし、なにもしない
-		} else {
-			// 変更あり、アップデート
-			log.Print("UPDATE documents")
-			rows, err = tx.Query(`
-			UPDATE documents
-			SET submitDateTime = $1,
-			    edinetCode = $2,
-				secCode = $3,
-				filerName = $4,
-				periodStart = $5,
-				periodEnd = $6,
-				docDescription = $7
-			WHERE date = $8 AND seqNumber = $9
-			`, result.SubmitDateTime, result.EdinetCode, result.SecCode,
-				result.FilerName, result.PeriodStart, result.PeriodEnd,
-				result.DocDescription, date, result.SeqNumber)
-
-			if err != nil {
-				log.Print("documentsテーブル 更新エラー")
-				tx.Rollback()
-				return err
-			}
-			rows.Close()
-		}
 	} else {
-		rows.Close()
 		// データなし、インサート
-		stmt, err := tx.Prepare("INSERT INTO documents(date,seqNumber,docID,submitDateTime,edinetCode,secCode,filerName,periodStart,periodEnd,docDescription) VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)")
+		_, err = tx.Exec(insertDocumentSQL(), documentValues(doc)...)
 		if err != nil {
-			log.Print("documentsテーブル insert prepareエラー")
+			log.Print("documentsテーブル insert execエラー")
 			tx.Rollback()
 			return err
 		}
-		_, err = stmt.Exec(date, result.SeqNumber, result.DocID,
-			result.SubmitDateTime, result.EdinetCode, result.SecCode,
-			result.FilerName, result.PeriodStart, result.PeriodEnd,
-			result.DocDescription)
+	}
+
+	// import で登録した書類（連番が負）が書類一覧APIに現れた場合は、書類一覧の情報に置き換える
+	if doc.SeqNumber > 0 {
+		_, err = tx.Exec(`DELETE FROM documents WHERE docID = $1 AND seqNumber < 0`, doc.DocID)
 		if err != nil {
-			log.Print("documentsテーブル insert execエラー")
+			log.Print("documentsテーブル delete エラー")
 			tx.Rollback()
 			return err
 		}
-		stmt.Close()
 	}
 
 	// document_textsテーブルの更新
-	// 同一キーレコードがあった場合、なにもしない。
-	// 同一キーレコードがなければインサートする
-	seq := 1
-	rows2, err := tx.Query(`
-		SELECT docID
-		FROM document_texts 
-		WHERE docID = $1
-		`, result.DocID)
+	// 登録済みのテキストは削除して、今回抽出したテキストに置き換える
+	// （同じトランザクションで行うので、検索で目次が欠けたり重複したりすることはない）
+	_, err = tx.Exec(`DELETE FROM document_texts WHERE docID = $1`, doc.DocID)
+	if err != nil {
+		log.Print("document_textsテーブル delete エラー")
+		tx.Rollback()
+		return err
+	}
+	err = s.insertSections(tx, doc.DocID, parsed)
 	if err != nil {
-		log.Print("document_textsテーブル select エラー")
+		log.Print("document_textsテーブル insert エラー")
 		tx.Rollback()
 		return err
 	}
-	if rows2.Next() {
-		rows2.Close()
-		// レコードがあればなにもしない
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// 再抽出の対象の書類のdocIDを取得する（取り下げられた書類は除く）
+func (s *sqlStore) ReextractTargets(opts reextractOptions) ([]string, error) {
+	var params []any
+	param := func(v any) string {
+		params = append(params, v)
+		return fmt.Sprintf("$%d", len(params))
+	}
+
+	conditions := []string{"M.withdrawalStatus IS DISTINCT FROM '2'"}
+	if opts.DocID != "" {
+		conditions = append(conditions, "M.docID = "+param(opts.DocID))
+	}
+	if !opts.Since.IsZero() {
+		conditions = append(conditions, "M.date >= "+param(opts.Since.Format(dateLayout)))
+	}
+	having := ""
+	if opts.OlderThanVersion > 0 {
+		// バージョンが不明（列の追加前に登録した）テキストは0とみなす
+		having = "HAVING MIN(COALESCE(T.extractor_version, 0)) < " + param(opts.OlderThanVersion)
+	}
+
+	rows, err := s.db.Query(`
+		SELECT M.docID
+		FROM documents M LEFT JOIN document_texts T ON T.docID = M.docID
+		WHERE `+strings.Join(conditions, " AND ")+`
+		GROUP BY M.docID
+		`+having+`
+		ORDER BY M.docID
+		`, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docIDs := make([]string, 0)
+	for rows.Next() {
+		var docID string
+		if err = rows.Scan(&docID); err != nil {
+			return nil, err
+		}
+		docIDs = append(docIDs, docID)
+	}
+	return docIDs, rows.Err()
+}
+
+// 書類の目次ごとのテキストを置き換える（documents テーブルは変更しない）
+// 登録済みのテキストと比べて、内容が変わった目次の数（追加、削除を含む）を返す
+func (s *sqlStore) ReplaceSections(docID string, parsed *extractor.ParsedDocument) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.Query(`SELECT title, breadcrumb, content FROM document_texts WHERE docID = $1 ORDER BY seq`, docID)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	stored := make([]extractor.Heading, 0)
+	for rows.Next() {
+		var h extractor.Heading
+		if err = rows.Scan(&h.Title, &h.Breadcrumb, &h.Content); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return 0, err
+		}
+		stored = append(stored, h)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM document_texts WHERE docID = $1`, docID)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	err = s.insertSections(tx, docID, parsed)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return changedSections(stored, parsed.Sections), tx.Commit()
+}
+
+// document_texts に目次ごとのテキストと抽出処理のバージョンを登録する
+// copyIn の場合は COPY でまとめて登録する
+func (s *sqlStore) insertSections(tx *sql.Tx, docID string, parsed *extractor.ParsedDocument) error {
+	var stmt *sql.Stmt
+	var err error
+	if s.copyIn {
+		// pq.CopyIn は列名を引用符で囲むので、小文字（PostgreSQLでの実際の列名）で指定する
+		stmt, err = tx.Prepare(pq.CopyIn("document_texts", "docid", "seq", "title", "breadcrumb", "content", "extractor_version"))
 	} else {
-		rows2.Close()
-		// レコードがないのでインサート
-		stmt2, err := tx.Prepare("INSERT INTO document_texts(docID,seq,title,breadcrumb,content) VALUES($1,$2,$3,$4,$5)")
+		stmt, err = tx.Prepare("INSERT INTO document_texts(docID,seq,title,breadcrumb,content,extractor_version) VALUES($1,$2,$3,$4,$5,$6)")
+	}
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i, h := range parsed.Sections {
+		_, err = stmt.Exec(docID, i+1, h.Title, h.Breadcrumb, h.Content, parsed.Version)
 		if err != nil {
-			log.Print("document_textsテーブル insert エラー")
-			tx.Rollback()
 			return err
 		}
+	}
+	if s.copyIn {
+		// 引数なしの Exec で COPY を完了する
+		_, err = stmt.Exec()
+	}
+	return err
+}
 
-		for _, s := range headings {
-			_, err = stmt2.Exec(result.DocID, seq, s.title, s.breadcrumb, s.content)
-			if err != nil {
-				tx.Rollback()
-				return err
-			}
-			seq++
+// 処理済み（チェックポイント）の最新の日付を取得する
+// チェックポイントがなければ ok に false を返す
+func (s *sqlStore) LastSyncedDate() (date time.Time, ok bool, err error) {
+	// SQLiteでは max(date) の型が日付にならないため、並べ替えて取得する
+	var d sql.NullTime
+	err = s.db.QueryRow(`SELECT date FROM sync_state ORDER BY date DESC LIMIT 1`).Scan(&d)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return dateInJST(d), d.Valid, nil
+}
+
+// 期間内の処理済み（チェックポイントを記録した）日付を取得する
+func (s *sqlStore) SyncedDates(from, to time.Time) ([]time.Time, error) {
+	rows, err := s.db.Query(`
+		SELECT date FROM sync_state
+		WHERE date >= $1 AND date <= $2
+		ORDER BY date
+		`, from.Format(dateLayout), to.Format(dateLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dates := make([]time.Time, 0)
+	for rows.Next() {
+		var d sql.NullTime
+		err = rows.Scan(&d)
+		if err != nil {
+			return nil, err
 		}
-		stmt2.Close()
+		dates = append(dates, dateInJST(d))
 	}
-	err = tx.Commit()
+	return dates, rows.Err()
+}
+
+// 1日分の処理が完了したことを記録する
+// processDateTime は書類一覧APIのメタデータの処理日時
+func (s *sqlStore) SaveSyncState(date string, processDateTime string, documentCount int) error {
+	processed, err := parseEdinetDateTime(processDateTime)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	_, err = s.db.Exec(`
+		INSERT INTO sync_state(date, processDateTime, documentCount, syncedAt)
+		VALUES($1, $2, $3, CURRENT_TIMESTAMP)
+		ON CONFLICT (date) DO UPDATE
+		SET processDateTime = EXCLUDED.processDateTime,
+			documentCount = EXCLUDED.documentCount,
+			syncedAt = EXCLUDED.syncedAt
+		`, date, nullTime(processed), documentCount)
+	return err
+}
+
+// 処理に失敗した書類
+type failedDocument struct {
+	DocID         string
+	Date          time.Time
+	Stage         string
+	Error         string
+	Attempts      int
+	LastAttemptAt time.Time
+	Result        edinet.Result
+}
+
+// 書類の処理に失敗したことを記録する。記録済みの場合は試行回数を増やす
+// 再処理のため、書類一覧APIの結果をJSONで保存しておく
+func (s *sqlStore) RecordFailure(date string, result edinet.Result, stage string, cause error) error {
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO failed_documents(docID, date, stage, error, attempts, lastAttemptAt, result)
+		VALUES($1, $2, $3, $4, 1, CURRENT_TIMESTAMP, $5)
+		ON CONFLICT (docID) DO UPDATE
+		SET date = EXCLUDED.date,
+			stage = EXCLUDED.stage,
+			error = EXCLUDED.error,
+			attempts = failed_documents.attempts + 1,
+			lastAttemptAt = EXCLUDED.lastAttemptAt,
+			result = EXCLUDED.result
+		`, result.DocID, date, stage, cause.Error(), string(resultJSON))
+	return err
+}
+
+// 処理に成功した（または再処理しない）書類を failed_documents から削除する。削除した場合はtrueを返す
+func (s *sqlStore) ClearFailure(docID string) (bool, error) {
+	r, err := s.db.Exec(`DELETE FROM failed_documents WHERE docID = $1`, docID)
+	if err != nil {
+		return false, err
+	}
+	n, err := r.RowsAffected()
+	return n > 0, err
+}
+
+// 処理に失敗した書類を日付、docIDの順で取得する
+func (s *sqlStore) FailedDocuments() ([]failedDocument, error) {
+	rows, err := s.db.Query(`
+		SELECT docID, date, stage, error, attempts, lastAttemptAt, result
+		FROM failed_documents
+		ORDER BY date DESC, docID
+		`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := make([]failedDocument, 0)
+	for rows.Next() {
+		var f failedDocument
+		var resultJSON string
+		var date sql.NullTime
+		err = rows.Scan(&f.DocID, &date, &f.Stage, &f.Error, &f.Attempts, &f.LastAttemptAt, &resultJSON)
+		if err != nil {
+			return nil, err
+		}
+		f.Date = dateInJST(date)
+		err = json.Unmarshal([]byte(resultJSON), &f.Result)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, f)
+	}
+	return docs, rows.Err()
+}
+
+// アーカイブに保存した書類のzipの記録を取得する。記録がなければ nil を返す
+func (s *sqlStore) ArchivedFile(docID string) (*archivedFile, error) {
+	var f archivedFile
+	err := s.db.QueryRow(`
+		SELECT docID, path, sha256, size, archivedAt
+		FROM archived_files
+		WHERE docID = $1
+		`, docID).Scan(&f.DocID, &f.Path, &f.SHA256, &f.Size, &f.ArchivedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// アーカイブに保存した書類のzipを記録する。記録済みの場合は置き換える
+func (s *sqlStore) RecordArchivedFile(f archivedFile) error {
+	_, err := s.db.Exec(`
+		INSERT INTO archived_files(docID, path, sha256, size, archivedAt)
+		VALUES($1, $2, $3, $4, CURRENT_TIMESTAMP)
+		ON CONFLICT (docID) DO UPDATE
+		SET path = EXCLUDED.path,
+			sha256 = EXCLUDED.sha256,
+			size = EXCLUDED.size,
+			archivedAt = EXCLUDED.archivedAt
+		`, f.DocID, f.Path, f.SHA256, f.Size)
+	return err
+}
+
+// アーカイブに保存した書類のzipの記録を削除する
+func (s *sqlStore) DeleteArchivedFile(docID string) error {
+	_, err := s.db.Exec(`DELETE FROM archived_files WHERE docID = $1`, docID)
+	return err
+}
+
+// アーカイブに保存した書類のzipの記録をdocIDの順で取得する
+func (s *sqlStore) ArchivedFiles() ([]archivedFile, error) {
+	rows, err := s.db.Query(`SELECT docID, path, sha256, size, archivedAt FROM archived_files ORDER BY docID`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := make([]archivedFile, 0)
+	for rows.Next() {
+		var f archivedFile
+		err = rows.Scan(&f.DocID, &f.Path, &f.SHA256, &f.Size, &f.ArchivedAt)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// 全文検索インデックスを作成するSQL（migrations/0001_initial.up.sql と同じ）
+const pgroongaIndexSQL = `CREATE INDEX IF NOT EXISTS pgroonga_content_index ON document_texts USING pgroonga (breadcrumb, content)`
+
+// 全文検索インデックスを再構築する
+// 一括登録モードの途中で終了してインデックスがない場合は作成する
+func (s *pgStore) Reindex() error {
+	var exists bool
+	err := s.db.QueryRow(`SELECT to_regclass('pgroonga_content_index') IS NOT NULL`).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		// 作成したインデックスは再構築する必要がない
+		_, err = s.db.Exec(pgroongaIndexSQL)
+		return err
+	}
+	_, err = s.db.Exec(`REINDEX INDEX pgroonga_content_index`)
+	return err
+}
+
+// 一括登録モードを開始する
+// 1行ごとにインデックスを更新しないよう、全文検索インデックスを削除する
+func (s *pgStore) BeginBulkLoad() error {
+	_, err := s.db.Exec(`DROP INDEX IF EXISTS pgroonga_content_index`)
+	return err
+}
+
+// 一括登録モードを終了する。全文検索インデックスを作成し直す
+func (s *pgStore) EndBulkLoad() error {
+	_, err := s.db.Exec(pgroongaIndexSQL)
+	return err
+}
+
+// docIDを指定して、登録済みの書類のステータスを取得する
+func (s *sqlStore) DocumentStatuses(docIDs []string) (map[string]docStatus, error) {
+	statuses := make(map[string]docStatus)
+	if len(docIDs) == 0 {
+		return statuses, nil
+	}
+
+	params := make([]string, len(docIDs))
+	args := make([]any, len(docIDs))
+	for i, id := range docIDs {
+		params[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = id
+	}
+	rows, err := s.db.Query(`
+		SELECT docID, COALESCE(withdrawalStatus, ''), COALESCE(docInfoEditStatus, ''), COALESCE(disclosureStatus, '')
+		FROM documents
+		WHERE docID IN (`+strings.Join(params, ",")+`)
+		`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var docID string
+		var st docStatus
+		err = rows.Scan(&docID, &st.Withdrawal, &st.DocInfoEdit, &st.Disclosure)
+		if err != nil {
+			return nil, err
+		}
+		statuses[docID] = st
+	}
+	return statuses, rows.Err()
+}
+
+// 書類のステータスを更新して、変更履歴を記録する
+// action が statusActionPurge の場合はテキストを削除する
+func (s *sqlStore) UpdateDocumentStatus(docID string, before, after docStatus, opeDateTime string, action string) error {
+	ope, err := parseEdinetDateTime(opeDateTime)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE documents
+		SET withdrawalStatus = $1,
+			docInfoEditStatus = $2,
+			disclosureStatus = $3
+		WHERE docID = $4
+		`, after.Withdrawal, after.DocInfoEdit, after.Disclosure, docID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	changes := []struct {
+		field         string
+		before, after string
+	}{
+		{"withdrawalStatus", before.Withdrawal, after.Withdrawal},
+		{"docInfoEditStatus", before.DocInfoEdit, after.DocInfoEdit},
+		{"disclosureStatus", before.Disclosure, after.Disclosure},
+	}
+	for _, c := range changes {
+		if c.before == c.after {
+			continue
+		}
+		_, err = tx.Exec(`
+			INSERT INTO document_status_log(docID, field, oldValue, newValue, opeDateTime, action)
+			VALUES($1, $2, $3, $4, $5, $6)
+			`, docID, c.field, nullIfEmpty(c.before), nullIfEmpty(c.after), nullTime(ope), action)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if action == statusActionPurge {
+		_, err = tx.Exec(`DELETE FROM document_texts WHERE docID = $1`, docID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// 空文字列をNULLとして扱う
+func nullIfEmpty(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// 検索結果（目次単位）
+type SearchHit struct {
+	DocID          string
+	FilerName      string
+	DocDescription string
+	DocTypeCode    string
+	SubmitDateTime time.Time // 不明の場合はゼロ値
+	Breadcrumb     string
+	Snippet        string // キーワードを <span class="keyword"> で囲んだHTML
+	LatestDocID    string // 訂正報告書を含めた最新の書類のdocID（訂正がなければ DocID と同じ）
+}
+
+// 訂正報告書が提出されている（最新の書類ではない）か
+func (h SearchHit) Amended() bool {
+	return h.LatestDocID != h.DocID
+}
+
+// 検索条件
+type searchOptions struct {
+	Query       string    // 検索キーワード
+	Breadcrumb  string    // 目次で絞り込むキーワード（空なら絞り込まない）
+	DocTypes    []string  // 書類種別コードで絞り込む（空なら絞り込まない）
+	AllVersions bool      // 訂正前の目次も検索対象にする
+	From        time.Time // 提出日がこの日以降の書類に絞り込む（ゼロ値なら絞り込まない）
+	To          time.Time // 提出日がこの日以前の書類に絞り込む（ゼロ値なら絞り込まない）
+	Oldest      bool      // 提出日時の古い順に並べる（デフォルトは新しい順）
+	Limit       int       // 最大件数（0以下なら制限しない）
+}
+
+// 訂正報告書とその訂正対象の書類をまとめるキー（訂正対象の書類のdocID）
+const chainRootColumn = `COALESCE(%[1]s.parentDocID, %[1]s.docID)`
+
+// docIDごとに1行（書類一覧の日付が最新の行）にする条件
+// EDINETはステータスが変更された書類をその日の書類一覧にも掲載するため、同じdocIDの行が複数ある場合がある
+const latestRowCondition = `NOT EXISTS (
+	SELECT 1 FROM documents N
+	WHERE N.docID = %[1]s.docID
+	AND   (N.date > %[1]s.date OR (N.date = %[1]s.date AND N.seqNumber > %[1]s.seqNumber)))`
+
+// 検索結果に表示する書類の条件（取り下げられた書類、不開示の書類を除く）
+const visibleCondition = `(%[1]s.withdrawalStatus IS DISTINCT FROM '2' AND COALESCE(%[1]s.disclosureStatus, '0') NOT IN ('1', '3'))`
+
+// 全文検索する
+// 訂正報告書が提出されている場合、デフォルトでは、後から提出された書類に同じ目次がある目次（訂正された目次）は除く
+func (s *pgStore) Search(opts searchOptions) ([]SearchHit, error) {
+	root := func(alias string) string { return fmt.Sprintf(chainRootColumn, alias) }
+	visible := func(alias string) string { return fmt.Sprintf(visibleCondition, alias) }
+	latest := func(alias string) string { return fmt.Sprintf(latestRowCondition, alias) }
+	order := "DESC"
+	if opts.Oldest {
+		order = "ASC"
+	}
+	sqlText := `
+		SELECT M.docID, COALESCE(M.filerName, ''), COALESCE(M.docDescription, ''), COALESCE(M.docTypeCode, ''), M.submitDateTime, D.breadcrumb,
+			(pgroonga_snippet_html(D.content, pgroonga_query_extract_keywords($1), 400))[1],
+			(SELECT L.docID FROM documents L
+			 WHERE ` + root("L") + ` = ` + root("M") + `
+			 AND   ` + visible("L") + `
+			 ORDER BY L.submitDateTime DESC, L.docID DESC LIMIT 1)
+		FROM documents M, document_texts D
+		WHERE M.docID = D.docID
+		AND   ` + visible("M") + `
+		AND   ` + latest("M") + `
+		AND   D.content &@~ $1
+		AND   ($2 = '' OR D.breadcrumb &@~ $2)
+		AND   (cardinality($3::text[]) = 0 OR M.docTypeCode = ANY($3))
+		AND   ($5::date IS NULL OR M.submitDateTime >= $5::date::timestamp AT TIME ZONE 'Asia/Tokyo')
+		AND   ($6::date IS NULL OR M.submitDateTime < ($6::date + 1)::timestamp AT TIME ZONE 'Asia/Tokyo')
+		AND   ($4 OR NOT EXISTS (
+			SELECT 1 FROM documents M2, document_texts D2
+			WHERE M2.docID = D2.docID
+			AND   ` + root("M2") + ` = ` + root("M") + `
+			AND   ` + visible("M2") + `
+			AND   ` + latest("M2") + `
+			AND   M2.submitDateTime > M.submitDateTime
+			AND   D2.breadcrumb = D.breadcrumb))
+		ORDER BY M.submitDateTime ` + order + ` NULLS LAST, M.docID, D.seq
+		`
+	docTypes := opts.DocTypes
+	if docTypes == nil {
+		docTypes = []string{}
+	}
+	params := []any{opts.Query, opts.Breadcrumb, pq.Array(docTypes), opts.AllVersions, nullDate(opts.From), nullDate(opts.To)}
+	if opts.Limit > 0 {
+		sqlText += " LIMIT $7"
+		params = append(params, opts.Limit)
+	}
+
+	rows, err := s.db.Query(sqlText, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hits := make([]SearchHit, 0)
+	for rows.Next() {
+		var h SearchHit
+		var snippet sql.NullString
+		var submitDateTime sql.NullTime
+		err = rows.Scan(&h.DocID, &h.FilerName, &h.DocDescription, &h.DocTypeCode, &submitDateTime, &h.Breadcrumb, &snippet, &h.LatestDocID)
+		if err != nil {
+			return nil, err
+		}
+		h.Snippet = snippet.String
+		h.SubmitDateTime = inJST(submitDateTime)
+		hits = append(hits, h)
+	}
+	return hits, rows.Err()
+}
+
+// 訂正の履歴に含まれる書類
+type chainDocument struct {
+	DocID          string
+	ParentDocID    string
+	DocTypeCode    string
+	FilerName      string
+	DocDescription string
+	SubmitDateTime time.Time // 不明の場合はゼロ値
+	Sections       []string  // 目次（パンくず）
+	Corrected      []string  // 前に提出された書類にもあり、内容が変わった目次（訂正された目次）
+}
+
+// docIDの書類の訂正の履歴（訂正対象の書類とその訂正報告書）を提出日時の順に取得する
+// 同じdocIDの行が複数ある場合は、書類一覧の日付が最新の行を使用する
+func (s *sqlStore) AmendmentChain(docID string) ([]chainDocument, error) {
+	root := func(alias string) string { return fmt.Sprintf(chainRootColumn, alias) }
+	latest := func(alias string) string { return fmt.Sprintf(latestRowCondition, alias) }
+	rows, err := s.db.Query(`
+		SELECT C.docID, COALESCE(C.parentDocID, ''), COALESCE(C.docTypeCode, ''), COALESCE(C.filerName, ''), COALESCE(C.docDescription, ''), C.submitDateTime
+		FROM documents C, documents M
+		WHERE M.docID = $1
+		AND   `+latest("M")+`
+		AND   `+latest("C")+`
+		AND   `+root("C")+` = `+root("M")+`
+		ORDER BY C.submitDateTime, C.docID
+		`, docID)
+	if err != nil {
+		return nil, err
+	}
+	chain := make([]chainDocument, 0)
+	for rows.Next() {
+		var c chainDocument
+		var submitDateTime sql.NullTime
+		err = rows.Scan(&c.DocID, &c.ParentDocID, &c.DocTypeCode, &c.FilerName, &c.DocDescription, &submitDateTime)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		c.SubmitDateTime = inJST(submitDateTime)
+		chain = append(chain, c)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 目次を取得して、前に提出された書類と内容が変わった目次を訂正された目次とする
+	earlier := make(map[string]string) // 目次（パンくず）ごとの、前に提出された書類の最新のテキスト
+	for i := range chain {
+		rows, err := s.db.Query(`SELECT breadcrumb, content FROM document_texts WHERE docID = $1 ORDER BY seq`, chain[i].DocID)
+		if err != nil {
+			return nil, err
+		}
+		sections := make([]extractor.Heading, 0)
+		for rows.Next() {
+			var h extractor.Heading
+			if err = rows.Scan(&h.Breadcrumb, &h.Content); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			sections = append(sections, h)
+			chain[i].Sections = append(chain[i].Sections, h.Breadcrumb)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+		chain[i].Corrected = correctedSections(earlier, sections)
+		for _, h := range sections {
+			earlier[h.Breadcrumb] = h.Content
+		}
+	}
+	return chain, nil
+}
+
+// 前に提出された書類にもあり、テキストが変わった目次（パンくず）を返す
+// earlier は目次ごとの前に提出された書類のテキスト。訂正報告書で追加された目次は含めない
+func correctedSections(earlier map[string]string, sections []extractor.Heading) []string {
+	corrected := make([]string, 0)
+	for _, h := range sections {
+		if before, ok := earlier[h.Breadcrumb]; ok && before != h.Content {
+			corrected = append(corrected, h.Breadcrumb)
+		}
+	}
+	return corrected
 }
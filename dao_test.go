@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"yakumo/extractor"
+)
+
+func TestCorrectedSections(t *testing.T) {
+	earlier := map[string]string{
+		"本文 > 企業情報 > 沿革":    "2【沿革】 1990年 設立",
+		"本文 > 企業情報 > 事業の内容": "3【事業の内容】 製造業",
+	}
+	tests := []struct {
+		name     string
+		sections []extractor.Heading
+		want     []string
+	}{
+		{
+			name: "変更なし",
+			sections: []extractor.Heading{
+				{Breadcrumb: "本文 > 企業情報 > 沿革", Content: "2【沿革】 1990年 設立"},
+				{Breadcrumb: "本文 > 企業情報 > 事業の内容", Content: "3【事業の内容】 製造業"},
+			},
+			want: []string{},
+		},
+		{
+			name: "テキストが変わった目次",
+			sections: []extractor.Heading{
+				{Breadcrumb: "本文 > 企業情報 > 沿革", Content: "2【沿革】 1991年 設立"},
+				{Breadcrumb: "本文 > 企業情報 > 事業の内容", Content: "3【事業の内容】 製造業"},
+			},
+			want: []string{"本文 > 企業情報 > 沿革"},
+		},
+		{
+			name: "追加された目次は含めない",
+			sections: []extractor.Heading{
+				{Breadcrumb: "本文 > 訂正報告書の提出理由", Content: "1【訂正報告書の提出理由】"},
+			},
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := correctedSections(earlier, tt.sections)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("correctedSections = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAmendmentChain(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+
+	// 訂正対象の書類
+	r := testResult(t)
+	doc, err := newDocument("2024-06-27", &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sections := []extractor.Heading{
+		{Title: "1【主要な経営指標等の推移】", Breadcrumb: "本文 > 主要な経営指標等の推移", Content: "売上高は増加した。"},
+		{Title: "2【沿革】", Breadcrumb: "本文 > 沿革", Content: "1990年 設立"},
+	}
+	err = s.SaveDocument(ctx, doc, &extractor.ParsedDocument{Sections: sections, Version: extractor.Version})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 沿革だけを訂正した訂正報告書
+	a := r
+	a.SeqNumber = 2
+	a.DocID = "S100AMND"
+	a.ParentDocID = "S100TEST"
+	a.DocTypeCode = "130"
+	a.SubmitDateTime = "2024-06-28 15:00"
+	amended, err := newDocument("2024-06-28", &a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sections = []extractor.Heading{
+		{Title: "1【主要な経営指標等の推移】", Breadcrumb: "本文 > 主要な経営指標等の推移", Content: "売上高は増加した。"},
+		{Title: "2【沿革】", Breadcrumb: "本文 > 沿革", Content: "1991年 設立"},
+	}
+	err = s.SaveDocument(ctx, amended, &extractor.ParsedDocument{Sections: sections, Version: extractor.Version})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, docID := range []string{"S100TEST", "S100AMND"} {
+		chain, err := s.AmendmentChain(docID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chain) != 2 || chain[0].DocID != "S100TEST" || chain[1].DocID != "S100AMND" {
+			t.Fatalf("AmendmentChain(%s) = %+v, want S100TEST, S100AMND", docID, chain)
+		}
+		if len(chain[0].Corrected) != 0 {
+			t.Errorf("訂正対象の書類の訂正された目次 = %q, want なし", chain[0].Corrected)
+		}
+		if want := []string{"本文 > 沿革"}; !reflect.DeepEqual(chain[1].Corrected, want) {
+			t.Errorf("訂正された目次 = %q, want %q", chain[1].Corrected, want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"yakumo/edinet"
+)
+
+// EDINETの日時のタイムゾーン（日本時間）
+var jst = time.FixedZone("JST", 9*60*60)
+
+// EDINET APIの日時の書式
+const dateTimeLayout = "2006-01-02 15:04"
+
+// 書類（documents テーブルの1行）
+// 日付、日時の項目が不明（APIの値が空、DBの値がNULL）の場合はゼロ値
+type Document struct {
+	Date                 time.Time // 書類一覧の日付
+	SeqNumber            int
+	DocID                string
+	EdinetCode           string
+	SecCode              string
+	Jcn                  string
+	FilerName            string
+	FundCode             string
+	OrdinanceCode        string
+	FormCode             string
+	DocTypeCode          string
+	PeriodStart          time.Time
+	PeriodEnd            time.Time
+	SubmitDateTime       time.Time
+	DocDescription       string
+	IssuerEdinetCode     string
+	SubjectEdinetCode    string
+	SubsidiaryEdinetCode string
+	CurrentReportReason  string
+	ParentDocID          string
+	OpeDateTime          time.Time
+	WithdrawalStatus     string
+	DocInfoEditStatus    string
+	DisclosureStatus     string
+	XbrlFlag             bool
+	PdfFlag              bool
+	AttachDocFlag        bool
+	EnglishDocFlag       bool
+	CsvFlag              bool
+	LegalStatus          string
+}
+
+// 書類一覧APIの結果から書類を作成する。date は書類一覧の日付（YYYY-MM-DD）
+func newDocument(date string, r *edinet.Result) (*Document, error) {
+	d := &Document{
+		SeqNumber:            r.SeqNumber,
+		DocID:                r.DocID,
+		EdinetCode:           r.EdinetCode,
+		SecCode:              r.SecCode,
+		Jcn:                  r.Jcn,
+		FilerName:            r.FilerName,
+		FundCode:             r.FundCode,
+		OrdinanceCode:        r.OrdinanceCode,
+		FormCode:             r.FormCode,
+		DocTypeCode:          r.DocTypeCode,
+		DocDescription:       r.DocDescription,
+		IssuerEdinetCode:     r.IssuerEdinetCode,
+		SubjectEdinetCode:    r.SubjectEdinetCode,
+		SubsidiaryEdinetCode: r.SubsidiaryEdinetCode,
+		CurrentReportReason:  r.CurrentReportReason,
+		ParentDocID:          r.ParentDocID,
+		WithdrawalStatus:     r.WithdrawalStatus,
+		DocInfoEditStatus:    r.DocInfoEditStatus,
+		DisclosureStatus:     r.DisclosureStatus,
+		XbrlFlag:             r.XbrlFlag == "1",
+		PdfFlag:              r.PdfFlag == "1",
+		AttachDocFlag:        r.AttachDocFlag == "1",
+		EnglishDocFlag:       r.EnglishDocFlag == "1",
+		CsvFlag:              r.CsvFlag == "1",
+		LegalStatus:          r.LegalStatus,
+	}
+
+	var err error
+	if d.Date, err = parseEdinetDate(date); err != nil {
+		return nil, err
+	}
+	if d.PeriodStart, err = parseEdinetDate(r.PeriodStart); err != nil {
+		return nil, err
+	}
+	if d.PeriodEnd, err = parseEdinetDate(r.PeriodEnd); err != nil {
+		return nil, err
+	}
+	if d.SubmitDateTime, err = parseEdinetDateTime(r.SubmitDateTime); err != nil {
+		return nil, err
+	}
+	if d.OpeDateTime, err = parseEdinetDateTime(r.OpeDateTime); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// EDINET APIの日付（YYYY-MM-DD）を解釈する。空の場合はゼロ値を返す
+func parseEdinetDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation(dateLayout, s, jst)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("日付が不正です: %q", s)
+	}
+	return t, nil
+}
+
+// EDINET APIの日時（YYYY-MM-DD hh:mm、日本時間）を解釈する。空の場合はゼロ値を返す
+func parseEdinetDateTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation(dateTimeLayout, s, jst)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("日時が不正です: %q", s)
+	}
+	return t, nil
+}
+
+// 日付が同じか（タイムゾーンによらず年月日で比較する）
+func sameDate(a, b time.Time) bool {
+	return a.Format(dateLayout) == b.Format(dateLayout)
+}
+
+// 書類一覧の内容（テキストの再作成が必要な項目）が同じか
+func (d *Document) sameListing(o *Document) bool {
+	return d.SubmitDateTime.Equal(o.SubmitDateTime) &&
+		d.EdinetCode == o.EdinetCode &&
+		d.SecCode == o.SecCode &&
+		d.FilerName == o.FilerName &&
+		sameDate(d.PeriodStart, o.PeriodStart) &&
+		sameDate(d.PeriodEnd, o.PeriodEnd) &&
+		d.DocDescription == o.DocDescription
+}
+
+// 日時を日本時間の YYYY-MM-DD hh:mm で表示する。ゼロ値の場合は空文字列
+func formatDateTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.In(jst).Format(dateTimeLayout)
+}
+
+// 日本時間のその日の0時
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, jst)
+}
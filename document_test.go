@@ -0,0 +1,117 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"yakumo/edinet"
+)
+
+func TestParseEdinetDate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{"2024-06-27", time.Date(2024, 6, 27, 0, 0, 0, 0, jst), false},
+		{"2024-02-29", time.Date(2024, 2, 29, 0, 0, 0, 0, jst), false},
+		{"", time.Time{}, false},
+		{"2023-02-29", time.Time{}, true},
+		{"2024-13-01", time.Time{}, true},
+		{"2024/06/27", time.Time{}, true},
+		{"2024-06-27 15:00", time.Time{}, true},
+		{"令和6年6月27日", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseEdinetDate(tt.in)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("parseEdinetDate(%q) = (%v, %v), want (%v, エラー %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseEdinetDateTime(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{"2024-06-27 15:00", time.Date(2024, 6, 27, 15, 0, 0, 0, jst), false},
+		{"2024-06-27 00:00", time.Date(2024, 6, 27, 0, 0, 0, 0, jst), false},
+		{"", time.Time{}, false},
+		{"2024-06-27", time.Time{}, true},
+		{"2024-06-27 24:00", time.Time{}, true},
+		{"2024-06-31 09:00", time.Time{}, true},
+		{"2024-06-27 15:00:00", time.Time{}, true},
+		{"2024-06-27T15:00", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseEdinetDateTime(tt.in)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("parseEdinetDateTime(%q) = (%v, %v), want (%v, エラー %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	// 日本時間として解釈する
+	got, err := parseEdinetDateTime("2024-06-27 09:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, 6, 27, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("parseEdinetDateTime = %v, want %v", got, want)
+	}
+}
+
+func TestNewDocument(t *testing.T) {
+	r := testResult(t)
+	doc, err := newDocument("2024-06-27", &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.DocID != r.DocID || doc.SeqNumber != r.SeqNumber || doc.FilerName != r.FilerName {
+		t.Errorf("書類 = %+v, want 書類一覧の値", doc)
+	}
+	if !doc.Date.Equal(time.Date(2024, 6, 27, 0, 0, 0, 0, jst)) {
+		t.Errorf("Date = %v, want 2024-06-27", doc.Date)
+	}
+	if got := formatDateTime(doc.SubmitDateTime); got != r.SubmitDateTime {
+		t.Errorf("SubmitDateTime = %q, want %q", got, r.SubmitDateTime)
+	}
+	if doc.PeriodStart.Format(dateLayout) != r.PeriodStart || doc.PeriodEnd.Format(dateLayout) != r.PeriodEnd {
+		t.Errorf("期間 = %v～%v, want %s～%s", doc.PeriodStart, doc.PeriodEnd, r.PeriodStart, r.PeriodEnd)
+	}
+	if doc.XbrlFlag != (r.XbrlFlag == "1") || doc.PdfFlag != (r.PdfFlag == "1") {
+		t.Errorf("フラグ = (%v, %v), want (%s, %s)", doc.XbrlFlag, doc.PdfFlag, r.XbrlFlag, r.PdfFlag)
+	}
+
+	// 取り下げられた書類等は日付の項目が空になる
+	empty := r
+	empty.PeriodStart, empty.PeriodEnd, empty.SubmitDateTime, empty.OpeDateTime = "", "", "", ""
+	doc, err = newDocument("2024-06-27", &empty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !doc.PeriodStart.IsZero() || !doc.PeriodEnd.IsZero() || !doc.SubmitDateTime.IsZero() || !doc.OpeDateTime.IsZero() {
+		t.Errorf("空の日付 = %+v, want ゼロ値", doc)
+	}
+
+	// 解釈できない日付はエラーにする
+	tests := []struct {
+		name   string
+		date   string
+		modify func(r *edinet.Result)
+	}{
+		{"書類一覧の日付", "2024-06-31", func(r *edinet.Result) {}},
+		{"期間（自）", "2024-06-27", func(r *edinet.Result) { r.PeriodStart = "2023/04/01" }},
+		{"期間（至）", "2024-06-27", func(r *edinet.Result) { r.PeriodEnd = "2024-02-30" }},
+		{"提出日時", "2024-06-27", func(r *edinet.Result) { r.SubmitDateTime = "2024-06-27" }},
+		{"操作日時", "2024-06-27", func(r *edinet.Result) { r.OpeDateTime = "2024-06-28 25:00" }},
+	}
+	for _, tt := range tests {
+		bad := r
+		tt.modify(&bad)
+		if _, err := newDocument(tt.date, &bad); err == nil {
+			t.Errorf("%s が不正な書類がエラーになりません", tt.name)
+		}
+	}
+}
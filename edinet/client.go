@@ -0,0 +1,233 @@
+// Package edinet は EDINET API (v2) のクライアントです。
+//
+// EDINET APIの利用にはAPIキーを取得する必要があります。
+// EDINET操作ガイド(下のURL) >  EDINET API利用規約 に記載の方法にてAPIキーを取得できます。
+//
+//	https://disclosure2dl.edinet-fsa.go.jp/guide/static/disclosure/WZEK0110.html
+package edinet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// EDINET API (v2) のベースURL
+const DefaultBaseURL = "https://api.edinet-fsa.go.jp/api/v2"
+
+// デフォルトのUser-Agent
+const DefaultUserAgent = "yakumo"
+
+// APIキー未設定エラー
+var ErrAPIKey = errors.New("edinet: API key is empty")
+
+// 書類一覧APIの取得情報（type パラメータ）
+type ListType int
+
+const (
+	ListMetadataOnly ListType = 1 // メタデータのみ
+	ListWithResults  ListType = 2 // 提出書類一覧及びメタデータ
+)
+
+// 書類取得APIの取得する書類（type パラメータ）
+type DocumentKind int
+
+const (
+	KindZip         DocumentKind = 1 // 提出本文書及び監査報告書（XBRLを含むzip）
+	KindPDF         DocumentKind = 2 // PDF
+	KindAttachments DocumentKind = 3 // 代替書面・添付文書（zip）
+	KindEnglish     DocumentKind = 4 // 英文ファイル（zip）
+	KindCSV         DocumentKind = 5 // XBRLから変換したCSV（zip）
+)
+
+// EDINET APIのクライアント
+type Client struct {
+	// APIのベースURL。空の場合は DefaultBaseURL を使用する
+	BaseURL string
+	// APIキー（Subscription-Key）
+	// APIの仕様によりURLのクエリで送信するが、返すエラーやログでは伏せ字にする
+	APIKey string
+	// リクエストに使用するHTTPクライアント。nilの場合は http.DefaultClient を使用する
+	HTTPClient *http.Client
+	// User-Agent ヘッダー。空の場合は DefaultUserAgent を使用する
+	UserAgent string
+	// リトライの設定。ゼロ値の場合はリトライしない
+	Retry RetryPolicy
+	// サーキットブレーカー。nilの場合は使用しない
+	Breaker *CircuitBreaker
+	// リクエストの間隔の制限（リトライも1回のリクエストに数える）。nilの場合は制限しない
+	Limiter *RateLimiter
+	// リトライ等のログ出力先。nilの場合は出力しない
+	Logf func(format string, v ...any)
+}
+
+// APIキーを指定してクライアントを作成する
+func NewClient(apiKey string) *Client {
+	return &Client{
+		BaseURL:    DefaultBaseURL,
+		APIKey:     apiKey,
+		HTTPClient: &http.Client{},
+		UserAgent:  DefaultUserAgent,
+		Retry:      DefaultRetryPolicy,
+		Breaker: &CircuitBreaker{
+			Threshold: DefaultBreakerThreshold,
+			Cooldown:  DefaultBreakerCooldown,
+		},
+	}
+}
+
+// 書類一覧を取得する。date は YYYY-MM-DD 形式
+func (c *Client) ListDocuments(ctx context.Context, date string, typ ListType) (*Documents, error) {
+	params := url.Values{}
+	params.Set("date", date)
+	params.Set("type", strconv.Itoa(int(typ)))
+
+	byteArray, err := c.fetch(ctx, "/documents.json", params, true)
+	if err != nil {
+		return nil, err
+	}
+
+	data := new(Documents)
+	if err := json.Unmarshal(byteArray, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// 書類を取得して w に書き込む
+// リトライ時に途中までのデータを書き込まないよう、取得が完了してから書き込む
+func (c *Client) Download(ctx context.Context, docID string, kind DocumentKind, w io.Writer) error {
+	params := url.Values{}
+	params.Set("type", strconv.Itoa(int(kind)))
+
+	byteArray, err := c.fetch(ctx, "/documents/"+url.PathEscape(docID), params, false)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(byteArray)
+	return err
+}
+
+// GETリクエストを送信してレスポンスのボディを返す
+// 失敗した場合はリトライの設定に従ってリトライする。
+// expectJSON は正常時のレスポンスがJSONの場合にtrueを指定する。
+// 返すエラーのメッセージにはAPIキーを含まない
+func (c *Client) fetch(ctx context.Context, path string, params url.Values, expectJSON bool) ([]byte, error) {
+	body, err := c.fetchWithRetry(ctx, path, params, expectJSON)
+	return body, c.redactError(err)
+}
+
+// リトライの設定に従ってリクエストを送信する
+func (c *Client) fetchWithRetry(ctx context.Context, path string, params url.Values, expectJSON bool) ([]byte, error) {
+	if c.APIKey == "" {
+		return nil, ErrAPIKey
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := c.Breaker.wait(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := c.fetchOnce(ctx, path, params, expectJSON)
+		if err == nil {
+			c.Breaker.success()
+			return body, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		if !isRetryable(err) {
+			// APIは応答しているのでブレーカーの失敗には数えない
+			c.Breaker.success()
+			return nil, err
+		}
+
+		if until, opened := c.Breaker.failure(); opened {
+			c.logf("edinet: API is unavailable, pausing requests until %s: %v", until.Format(time.RFC3339), err)
+		}
+		if attempt >= c.Retry.MaxAttempts {
+			return nil, err
+		}
+
+		delay := c.Retry.backoff(attempt)
+		var ae *APIError
+		if errors.As(err, &ae) && ae.RetryAfter > delay {
+			delay = ae.RetryAfter
+		}
+		c.logf("edinet: %s failed (attempt %d/%d), retrying in %s: %v", path, attempt, c.Retry.MaxAttempts, delay.Round(time.Millisecond), err)
+		err = sleep(ctx, delay)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// GETリクエストを1回送信してレスポンスのボディを返す。APIがエラーを返した場合は *APIError を返す
+func (c *Client) fetchOnce(ctx context.Context, path string, params url.Values, expectJSON bool) ([]byte, error) {
+	err := c.Limiter.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Retry.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Retry.RequestTimeout)
+		defer cancel()
+	}
+
+	baseURL := c.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	q := url.Values{}
+	for k, v := range params {
+		q[k] = v
+	}
+	q.Set("Subscription-Key", c.APIKey)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+path+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	userAgent := c.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	err = checkResponse(resp, body, expectJSON)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// ログを出力する。APIキーは伏せ字にする
+func (c *Client) logf(format string, v ...any) {
+	if c.Logf != nil {
+		c.Logf("%s", c.Redact(fmt.Sprintf(format, v...)))
+	}
+}
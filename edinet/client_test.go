@@ -0,0 +1,171 @@
+package edinet
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 書類一覧APIの正常時のレスポンス
+const okBody = `{"metadata":{"status":"200","message":"OK"},"results":[]}`
+
+// handler をテスト用のサーバーで動かし、そのサーバーを使うクライアントを返す
+// リトライの待ち時間は短くし、ブレーカーは使わない
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	c := NewClient("test-api-key")
+	c.BaseURL = srv.URL
+	c.Retry = RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+	c.Breaker = nil
+	return c
+}
+
+func writeOK(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(okBody))
+}
+
+func TestRetryServerError(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		writeOK(w)
+	})
+
+	_, err := c.ListDocuments(context.Background(), "2024-06-27", ListWithResults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("リクエスト数 = %d, want 3", n)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		writeOK(w)
+	})
+
+	// バックオフ（数ミリ秒）より Retry-After（1秒）を優先する
+	start := time.Now()
+	_, err := c.ListDocuments(context.Background(), "2024-06-27", ListWithResults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < time.Second {
+		t.Errorf("待ち時間 = %s, want >= 1s", d)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("リクエスト数 = %d, want 2", n)
+	}
+}
+
+func TestInvalidAPIKeyNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"statusCode":401,"message":"Access denied due to invalid subscription key."}`))
+	})
+
+	_, err := c.ListDocuments(context.Background(), "2024-06-27", ListWithResults)
+	if !errors.Is(err, ErrInvalidAPIKey) {
+		t.Fatalf("err = %v, want ErrInvalidAPIKey", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("リクエスト数 = %d, want 1", n)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			// 1回目はタイムアウトするまで応答しない
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		writeOK(w)
+	})
+	c.Retry.RequestTimeout = 50 * time.Millisecond
+
+	_, err := c.ListDocuments(context.Background(), "2024-06-27", ListWithResults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("リクエスト数 = %d, want 2", n)
+	}
+}
+
+func TestCircuitBreakerOpens(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	c.Retry.MaxAttempts = 2
+	c.Breaker = &CircuitBreaker{Threshold: 2, Cooldown: time.Minute}
+
+	// リトライがすべて失敗した時点でブレーカーが開く
+	_, err := c.ListDocuments(context.Background(), "2024-06-27", ListWithResults)
+	if !errors.Is(err, ErrServerError) {
+		t.Fatalf("err = %v, want ErrServerError", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("リクエスト数 = %d, want 2", n)
+	}
+
+	// ブレーカーが開いている間は、リクエストを送らずに待つ
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = c.ListDocuments(ctx, "2024-06-28", ListWithResults)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("ブレーカーが開いた後のリクエスト数 = %d, want 2", n)
+	}
+}
+
+func TestRateLimiterCountsRetries(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		writeOK(w)
+	})
+	c.Limiter = NewRateLimiter(10)
+
+	// 3回のリクエスト（リトライ2回を含む）の間隔は、それぞれ0.1秒以上になる
+	start := time.Now()
+	_, err := c.ListDocuments(context.Background(), "2024-06-27", ListWithResults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 200*time.Millisecond {
+		t.Errorf("処理時間 = %s, want >= 200ms", d)
+	}
+}
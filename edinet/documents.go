@@ -0,0 +1,56 @@
+package edinet
+
+// 書類一覧APIのレスポンス
+// https://disclosure2dl.edinet-fsa.go.jp/guide/static/disclosure/WZEK0110.html
+
+// 書類一覧JSONの構造体
+type Documents struct {
+	Metadata `json:"metadata"`
+	Results  []Result `json:"results"`
+}
+
+type Metadata struct {
+	Title     string `json:"title"`
+	Parameter struct {
+		Date string `json:"date"`
+		Type string `json:"type"`
+	} `json:"parameter"`
+	Resultset struct {
+		Count int `json:"count"`
+	} `json:"resultset"`
+	ProcessDateTime string `json:"processDateTime"`
+	Status          string `json:"status"`
+	Message         string `json:"message"`
+}
+
+type Result struct {
+	SeqNumber            int    `json:"seqNumber"`
+	DocID                string `json:"docID"`
+	EdinetCode           string `json:"edinetCode"`
+	SecCode              string `json:"secCode"`
+	Jcn                  string `json:"JCN"`
+	FilerName            string `json:"filerName"`
+	FundCode             string `json:"fundCode"`
+	OrdinanceCode        string `json:"ordinanceCode"`
+	FormCode             string `json:"formCode"`
+	DocTypeCode          string `json:"docTypeCode"`
+	PeriodStart          string `json:"periodStart"`
+	PeriodEnd            string `json:"periodEnd"`
+	SubmitDateTime       string `json:"submitDateTime"`
+	DocDescription       string `json:"docDescription"`
+	IssuerEdinetCode     string `json:"issuerEdinetCode"`
+	SubjectEdinetCode    string `json:"subjectEdinetCode"`
+	SubsidiaryEdinetCode string `json:"subsidiaryEdinetCode"`
+	CurrentReportReason  string `json:"currentReportReason"`
+	ParentDocID          string `json:"parentDocID"`
+	OpeDateTime          string `json:"opeDateTime"`
+	WithdrawalStatus     string `json:"withdrawalStatus"`
+	DocInfoEditStatus    string `json:"docInfoEditStatus"`
+	DisclosureStatus     string `json:"disclosureStatus"`
+	XbrlFlag             string `json:"xbrlFlag"`
+	PdfFlag              string `json:"pdfFlag"`
+	AttachDocFlag        string `json:"attachDocFlag"`
+	EnglishDocFlag       string `json:"englishDocFlag"`
+	CsvFlag              string `json:"csvFlag"`
+	LegalStatus          string `json:"legalStatus"`
+}
@@ -0,0 +1,131 @@
+package edinet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIが返したエラーの分類
+// APIError を errors.Is で判定するために使用する
+var (
+	ErrBadRequest    = errors.New("edinet: bad request")
+	ErrInvalidAPIKey = errors.New("edinet: invalid API key")
+	ErrNotFound      = errors.New("edinet: not found")
+	ErrRateLimited   = errors.New("edinet: rate limited")
+	ErrServerError   = errors.New("edinet: server error")
+)
+
+// APIがエラーを返した場合のエラー
+// HTTPステータスのほか、HTTPステータスが200でもJSONの metadata.status がエラーを示している場合に返す
+type APIError struct {
+	// HTTPステータス、またはJSONの metadata.status の値
+	StatusCode int
+	// APIが返したエラーメッセージ
+	Message string
+	// Retry-After ヘッダーで指定された待ち時間
+	RetryAfter time.Duration
+	// エラーの分類（ErrInvalidAPIKey 等）。分類できない場合はnil
+	Kind error
+}
+
+func (e *APIError) Error() string {
+	kind := "edinet: API error"
+	if e.Kind != nil {
+		kind = e.Kind.Error()
+	}
+	if e.Message == "" {
+		return fmt.Sprintf("%s (status %d)", kind, e.StatusCode)
+	}
+	return fmt.Sprintf("%s (status %d): %s", kind, e.StatusCode, e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Kind
+}
+
+// ステータスコードからエラーの分類を求める
+func errorKind(status int) error {
+	switch {
+	case status == http.StatusBadRequest:
+		return ErrBadRequest
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrInvalidAPIKey
+	case status == http.StatusNotFound:
+		return ErrNotFound
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case status >= 500:
+		return ErrServerError
+	}
+	return nil
+}
+
+// エラー時のJSON
+// EDINET APIは metadata.status と metadata.message でエラーを返す。
+// APIキーが不正な場合等は、APIの手前のゲートウェイが statusCode と message で返す
+type errorPayload struct {
+	Metadata struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	} `json:"metadata"`
+	StatusCode int    `json:"statusCode"`
+	Message    string `json:"message"`
+}
+
+// JSONのエラー情報を読み取る。エラー情報がない場合は status に0を返す
+func parseErrorPayload(body []byte) (status int, message string) {
+	var p errorPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return 0, ""
+	}
+	if p.Metadata.Status != "" {
+		status, _ = strconv.Atoi(p.Metadata.Status)
+		return status, p.Metadata.Message
+	}
+	return p.StatusCode, p.Message
+}
+
+// レスポンスがJSONかどうか
+func isJSON(header http.Header) bool {
+	return strings.Contains(header.Get("Content-Type"), "json")
+}
+
+// レスポンスのステータス、Content-Type、ボディからエラーを判定する
+// expectJSON は正常時のレスポンスがJSONの場合（書類一覧API）にtrueを指定する
+func checkResponse(resp *http.Response, body []byte, expectJSON bool) error {
+	retryAfter, _ := retryAfter(resp.Header)
+
+	if resp.StatusCode != http.StatusOK {
+		e := &APIError{StatusCode: resp.StatusCode, RetryAfter: retryAfter, Kind: errorKind(resp.StatusCode)}
+		if status, message := parseErrorPayload(body); message != "" {
+			e.Message = message
+			if e.Kind == nil {
+				e.StatusCode = status
+				e.Kind = errorKind(status)
+			}
+		} else {
+			e.Message = resp.Status
+		}
+		return e
+	}
+
+	if !expectJSON && !isJSON(resp.Header) {
+		// 書類取得APIは正常時にはJSON以外を返す
+		return nil
+	}
+
+	status, message := parseErrorPayload(body)
+	if status == 0 || status == http.StatusOK {
+		if !expectJSON {
+			// 書類取得APIでJSONが返ってきた場合はエラー
+			return &APIError{StatusCode: resp.StatusCode, Message: "unexpected JSON response"}
+		}
+		return nil
+	}
+	return &APIError{StatusCode: status, Message: message, RetryAfter: retryAfter, Kind: errorKind(status)}
+}
@@ -0,0 +1,40 @@
+package edinet
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// リクエストの間隔の制限
+// リトライを含むすべてのリクエストの前に待つ。複数のgoroutineから同時に使用できる
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// 1秒あたりの最大リクエスト数を指定して作成する。0以下の場合は制限しない（nilを返す）
+func NewRateLimiter(perSecond float64) *RateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &RateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// 次のリクエストが可能になるまで待つ。待っている間に ctx がキャンセルされた場合は ctx のエラーを返す
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	return sleep(ctx, wait)
+}
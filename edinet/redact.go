@@ -0,0 +1,57 @@
+package edinet
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// APIキーを伏せた後の文字列
+const redacted = "REDACTED"
+
+// s に含まれるAPIキーを伏せ字にして返す
+// ログ等にAPIキーが出力されないようにするために使用する
+func (c *Client) Redact(s string) string {
+	if c.APIKey == "" {
+		return s
+	}
+	s = strings.ReplaceAll(s, c.APIKey, redacted)
+	if escaped := url.QueryEscape(c.APIKey); escaped != c.APIKey {
+		s = strings.ReplaceAll(s, escaped, redacted)
+	}
+	return s
+}
+
+// APIキーを伏せたエラー
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+// errors.Is 等で元のエラーを判定できるようにする
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// エラーメッセージからAPIキーを伏せる
+// http.Client が返す *url.Error はリクエストのURL（APIキーを含む）をメッセージに含むため、URLを伏せたものに置き換える
+func (c *Client) redactError(err error) error {
+	if err == nil || c.APIKey == "" {
+		return err
+	}
+
+	var ue *url.Error
+	if errors.As(err, &ue) && ue == err {
+		err = &url.Error{Op: ue.Op, URL: c.Redact(ue.URL), Err: c.redactError(ue.Err)}
+	}
+
+	msg := err.Error()
+	if redactedMsg := c.Redact(msg); redactedMsg != msg {
+		return &redactedError{msg: redactedMsg, err: err}
+	}
+	return err
+}
@@ -0,0 +1,158 @@
+package edinet
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// リトライの設定
+type RetryPolicy struct {
+	// 最大試行回数（最初の1回を含む）。1以下の場合はリトライしない
+	MaxAttempts int
+	// 1回目のリトライまでの待ち時間。リトライのたびに2倍になる
+	BaseDelay time.Duration
+	// 待ち時間の上限
+	MaxDelay time.Duration
+	// 1回のリクエスト（レスポンスの読み込みを含む）のタイムアウト。0の場合は制限しない
+	RequestTimeout time.Duration
+}
+
+// デフォルトのリトライ設定
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	BaseDelay:      2 * time.Second,
+	MaxDelay:       2 * time.Minute,
+	RequestTimeout: 3 * time.Minute,
+}
+
+// n回目（1始まり）のリトライまでの待ち時間を返す
+// 指数バックオフの値の半分を固定、残りの半分をランダム（ジッター）にする
+func (p RetryPolicy) backoff(n int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < n && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// リトライで回復する可能性があるエラーかどうか
+func isRetryable(err error) bool {
+	var ae *APIError
+	if errors.As(err, &ae) {
+		return errors.Is(err, ErrRateLimited) || errors.Is(err, ErrServerError)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		// 1回のリクエストのタイムアウト
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+// Retry-After ヘッダーの値（秒数またはHTTP日付）から待ち時間を求める
+func retryAfter(header http.Header) (time.Duration, bool) {
+	v := header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if sec, err := strconv.Atoi(v); err == nil {
+		if sec < 0 {
+			return 0, false
+		}
+		return time.Duration(sec) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// ctx がキャンセルされるまでの間 d だけ待つ
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// サーキットブレーカー
+// APIが明らかに停止している（連続して失敗する）場合に、一定時間すべてのリクエストを止める。
+// 複数のgoroutineから同時に使用できる
+type CircuitBreaker struct {
+	// 連続失敗回数がこの値に達したらリクエストを止める。0以下の場合は止めない
+	Threshold int
+	// リクエストを止める時間
+	Cooldown time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// デフォルトのサーキットブレーカーの設定
+// デフォルトのリトライ設定では、1つのリクエストのリトライがすべて失敗した時点で止まる
+const (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 5 * time.Minute
+)
+
+// リクエストが可能になるまで待つ
+func (b *CircuitBreaker) wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	d := time.Until(b.openUntil)
+	b.mu.Unlock()
+	return sleep(ctx, d)
+}
+
+// 成功を記録する
+func (b *CircuitBreaker) success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.failures = 0
+	b.mu.Unlock()
+}
+
+// 失敗を記録する。リクエストを止めた場合はその期限を返す
+func (b *CircuitBreaker) failure() (time.Time, bool) {
+	if b == nil || b.Threshold <= 0 {
+		return time.Time{}, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.failures < b.Threshold || time.Now().Before(b.openUntil) {
+		return time.Time{}, false
+	}
+	// 止めた後の最初のリクエストが失敗した場合も、再度止める
+	b.openUntil = time.Now().Add(b.Cooldown)
+	return b.openUntil, true
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
+	"log"
 	"os"
+	"strings"
+
+	"yakumo/edinet"
 )
 
 // EDINET APIの利用にはAPIキーを取得する必要があります。
@@ -14,113 +17,61 @@ import (
 //
 //	https://disclosure2dl.edinet-fsa.go.jp/guide/static/disclosure/WZEK0110.html
 //
-// EDINET API のキー：環境変数 YAKUMO_EDINET_API_KEY より取得
-var apiKey string = os.Getenv("YAKUMO_EDINET_API_KEY")
-
-// APIキー未設定エラー
-var ErrApikey error = errors.New("ApiKey is empty")
-
-// 書類一覧取得APIのURLの書式
-var apiDocumentsUrlFormat string = "https://api.edinet-fsa.go.jp/api/v2/documents.json?date=%s&type=2&Subscription-Key=%s"
+// EDINET API のキー：環境変数 YAKUMO_EDINET_API_KEY_FILE で指定したファイル（Docker/Kubernetesのシークレット等）、
+// または環境変数 YAKUMO_EDINET_API_KEY より取得
+func loadAPIKey() (string, error) {
+	if path := os.Getenv("YAKUMO_EDINET_API_KEY_FILE"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("APIキーのファイルを読み込めません: %w", err)
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	return os.Getenv("YAKUMO_EDINET_API_KEY"), nil
+}
 
-// 日付を指定して書類一覧取得APIのURL
-func urlOfDocuments(date string) string {
-	return fmt.Sprintf(apiDocumentsUrlFormat, date, apiKey)
+// EDINET APIのベースURL：環境変数 YAKUMO_EDINET_BASE_URL より取得（省略時は本番のAPI）
+// yakumo fake-edinet 等、本番以外のAPIを使用する場合に指定する
+func defaultEdinetURL() string {
+	if u := os.Getenv("YAKUMO_EDINET_BASE_URL"); u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	return edinet.DefaultBaseURL
 }
 
-// 書類一覧JSONの構造体
-type Documents struct {
-	Metadata `json:"metadata"`
-	Results  []Result `json:"results"`
+// EDINET APIのクライアントを作成する。リトライ等のログは標準のロガーに出力する
+func newEdinetClient() *edinet.Client {
+	c := edinet.NewClient("")
+	c.Logf = log.Printf
+	return c
 }
 
-type Metadata struct {
-	Title     string `json:"title"`
-	Parameter struct {
-		Date string `json:"date"`
-		Type string `json:"type"`
-	} `json:"parameter"`
-	Resultset struct {
-		Count int `json:"count"`
-	} `json:"resultset"`
-	ProcessDateTime string `json:"processDateTime"`
-	Status          string `json:"status"`
-	Message         string `json:"message"`
+// ログに出力する内容からAPIキー（client に設定したもの）を伏せる
+type redactWriter struct {
+	w      io.Writer
+	client *edinet.Client
 }
 
-type Result struct {
-	SeqNumber            int    `json:"seqNumber"`
-	DocID                string `json:"docID"`
-	EdinetCode           string `json:"edinetCode"`
-	SecCode              string `json:"secCode"`
-	Jcn                  string `json:"JCN"`
-	FilerName            string `json:"filerName"`
-	FundCode             string `json:"fundCode"`
-	OrdinanceCode        string `json:"ordinanceCode"`
-	FormCode             string `json:"formCode"`
-	DocTypeCode          string `json:"docTypeCode"`
-	PeriodStart          string `json:"periodStart"`
-	PeriodEnd            string `json:"periodEnd"`
-	SubmitDateTime       string `json:"submitDateTime"`
-	DocDescription       string `json:"docDescription"`
-	IssuerEdinetCode     string `json:"issuerEdinetCode"`
-	SubjectEdinetCode    string `json:"subjectEdinetCode"`
-	SubsidiaryEdinetCode string `json:"subsidiaryEdinetCode"`
-	CurrentReportReason  string `json:"currentReportReason"`
-	ParentDocID          string `json:"parentDocID"`
-	OpeDateTime          string `json:"opeDateTime"`
-	WithdrawalStatus     string `json:"withdrawalStatus"`
-	DocInfoEditStatus    string `json:"docInfoEditStatus"`
-	DisclosureStatus     string `json:"disclosureStatus"`
-	XbrlFlag             string `json:"xbrlFlag"`
-	PdfFlag              string `json:"pdfFlag"`
-	AttachDocFlag        string `json:"attachDocFlag"`
-	EnglishDocFlag       string `json:"englishDocFlag"`
-	CsvFlag              string `json:"csvFlag"`
-	LegalStatus          string `json:"legalStatus"`
+func (r redactWriter) Write(p []byte) (int, error) {
+	_, err := io.WriteString(r.w, r.client.Redact(string(p)))
+	return len(p), err
 }
 
 // 書類一覧取得
-func GetDocuments(date string) (*Documents, error) {
-	if apiKey == "" {
-		return nil, ErrApikey
-	}
-	url := urlOfDocuments(date)
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-
-	defer resp.Body.Close()
-	byteArray, err := io.ReadAll(resp.Body)
+func GetDocuments(ctx context.Context, c *edinet.Client, date string) (*edinet.Documents, error) {
+	docs, err := c.ListDocuments(ctx, date, edinet.ListWithResults)
 	if err != nil {
-		return nil, err
-	}
-
-	data := new(Documents)
-	if err := json.Unmarshal(byteArray, data); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("書類一覧取得 %s: %s: %w", date, apiErrorMessage(err), err)
 	}
-
-	return data, nil
-}
-
-// 書類取得APIのURLの書式
-var apiDownloadZipUrlFormat string = "https://api.edinet-fsa.go.jp/api/v2/documents/%s?type=1&Subscription-Key=%s"
-
-// 書類取得APIのURL
-func urlOfTheZip(docID string) string {
-	return fmt.Sprintf(apiDownloadZipUrlFormat, docID, apiKey)
+	return docs, nil
 }
 
 // 本文ZIPを取得する
-func DownloadZip(docID string, filepath string) error {
-	if apiKey == "" {
-		return ErrApikey
+func DownloadZip(ctx context.Context, c *edinet.Client, docID string, filepath string) error {
+	if c.APIKey == "" {
+		return edinet.ErrAPIKey
 	}
 
-	url := urlOfTheZip(docID)
-
 	// Create the file
 	out, err := os.Create(filepath)
 	if err != nil {
@@ -129,17 +80,28 @@ func DownloadZip(docID string, filepath string) error {
 	defer out.Close()
 
 	// Get the data
-	resp, err := http.Get(url)
+	err = c.Download(ctx, docID, edinet.KindZip, out)
 	if err != nil {
-		return err
+		return fmt.Errorf("書類取得 %s: %s: %w", docID, apiErrorMessage(err), err)
 	}
-	defer resp.Body.Close()
+	return nil
+}
 
-	// Writer the body to file
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
-		return err
+// EDINET APIのエラーの説明を返す
+func apiErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, edinet.ErrAPIKey):
+		return "EDINET APIキーが設定されていません。環境変数 YAKUMO_EDINET_API_KEY または YAKUMO_EDINET_API_KEY_FILE を設定してください"
+	case errors.Is(err, edinet.ErrInvalidAPIKey):
+		return "EDINET APIキーが無効です。環境変数 YAKUMO_EDINET_API_KEY または YAKUMO_EDINET_API_KEY_FILE を確認してください"
+	case errors.Is(err, edinet.ErrNotFound):
+		return "EDINET APIで対象が見つかりません"
+	case errors.Is(err, edinet.ErrRateLimited):
+		return "EDINET APIのリクエスト数の制限を超えました"
+	case errors.Is(err, edinet.ErrServerError):
+		return "EDINET APIでサーバーエラーが発生しました"
+	case errors.Is(err, edinet.ErrBadRequest):
+		return "EDINET APIへのリクエストが不正です"
 	}
-
-	return nil
+	return "EDINET APIの呼び出しに失敗しました"
 }
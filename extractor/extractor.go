@@ -0,0 +1,373 @@
+package extractor
+
+// 有価証券報告書のzipから目次ごとの検索用テキストを抽出する処理
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// 有価証券報告書等のzip（またはその解凍先のディレクトリ）から、目次ごとの検索用テキストを抽出する。
+// 状態を持たないので、複数のgoroutineから同時に使用できる。
+type Extractor struct {
+	// zipを解凍するワークディレクトリを作成する場所。空の場合は os.TempDir() を使用する
+	TempDir string
+}
+
+// 抽出処理のバージョン
+// 抽出結果が変わる修正（htmlToText の改善等）をしたら1つ上げる
+const Version = 1
+
+// 目次ごとのタイトルとパンくずと本文
+type Heading struct {
+	Title      string
+	Breadcrumb string
+	Content    string
+}
+
+// 抽出結果
+type ParsedDocument struct {
+	// 目次ごとのテキスト（表紙、本文の目次順、監査報告書の順）
+	Sections []Heading
+	// 抽出した処理のバージョン（Version）
+	Version int
+}
+
+// zipファイルから検索用のテキストを抽出する
+func (e *Extractor) ExtractZip(zipfile string) (*ParsedDocument, error) {
+	return e.ExtractZipContext(context.Background(), zipfile)
+}
+
+// zipファイルから検索用のテキストを抽出する
+// ctx がキャンセルされた場合は、ワークディレクトリを削除して ctx のエラーを返す
+func (e *Extractor) ExtractZipContext(ctx context.Context, zipfile string) (*ParsedDocument, error) {
+
+	// zipを安全に解凍するワークディレクトリを作成
+	tempDir := e.TempDir
+	if tempDir == "" {
+		tempDir = os.TempDir()
+	}
+	workDir, err := os.MkdirTemp(tempDir, "zipext_*")
+	if err != nil {
+		return nil, err
+	}
+
+	// 作業後にワークディレクトリを削除
+	defer os.RemoveAll(workDir)
+
+	// zipを解凍
+	_, err = UnzipContext(ctx, zipfile, workDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// テキストを作成
+	return e.Extract(workDir)
+}
+
+// 解凍済みのディレクトリ内のhtmlファイル群から検索用のテキストを抽出する
+func (e *Extractor) Extract(dirpath string) (*ParsedDocument, error) {
+	// htmlファイルのリストを取得
+	htmls, err := listHtmlFiles(dirpath)
+	if err != nil {
+		return nil, err
+	}
+
+	// 並び変え
+	sortHtmlList(htmls)
+
+	// 空白文字、全角スペース、ノーブレークスペースが１つ以上連続するパターン
+	rep := regexp.MustCompile(`[\s　\xA0\n]+`)
+
+	// 目次スライスの初期化
+	doc := &ParsedDocument{Sections: make([]Heading, 0), Version: Version}
+
+	// 各ファイルを順次処理して目次スライスに設定していく
+	var inAudit bool
+	for _, v := range *htmls {
+		fp, err := os.Open(v)
+		if err != nil {
+			return nil, err
+		}
+		defer fp.Close()
+
+		// 監査報告書の最初のhtmlであるか
+		firstHtmlOfAuditDoc := false
+		if !inAudit && strings.Contains(v, "AuditDoc") {
+			firstHtmlOfAuditDoc = true
+			inAudit = true
+		}
+
+		err = doc.htmlToText(fp, firstHtmlOfAuditDoc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 目次ごとのテキストから余分なスペースを除外する
+	for i := range doc.Sections {
+		// 空白文字、全角スペース、ノーブレークスペースが１つ以上連続する箇所半角スペース１つに置き換える。
+		t := rep.ReplaceAllString(doc.Sections[i].Content, " ")
+		// 前後の半角スペースは削除
+		doc.Sections[i].Content = strings.Trim(t, " ")
+	}
+
+	// パンくず設定
+	doc.setBreadcrumb()
+	return doc, nil
+}
+
+// 処理したい順番（本文->監査報告書）にソートする
+func sortHtmlList(list *[]string) {
+	sort.Slice(*list, func(i, j int) bool {
+		cmpSrc := func(src string) string {
+			tmp := strings.Replace(src, "AuditDoc", "ZZZ", 1)
+			return strings.Replace(tmp, "PublicDoc", "AAA", 1)
+		}
+		t1 := cmpSrc((*list)[i])
+		t2 := cmpSrc((*list)[j])
+		return strings.Compare(t1, t2) < 0
+	})
+}
+
+// 特定のディレクトリ内のhtmlファイルをリストする
+func listHtmlFiles(dirPath string) (*[]string, error) {
+	var paths []string
+	// WalkDirを使ってディレクトリを再帰的に探索
+	err := filepath.WalkDir(dirPath, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// ディレクトリを除外
+		if !d.IsDir() {
+			// 拡張子でhtmlファイルを識別
+			if strings.HasSuffix(path, ".htm") ||
+				strings.HasSuffix(path, ".html") {
+				paths = append(paths, path)
+			}
+		}
+		return nil
+	})
+	return &paths, err
+}
+
+// htmlから検索用のテキストを作成して Sections に追加する
+func (doc *ParsedDocument) htmlToText(r io.Reader, firstHtmlOfAuditDoc bool) error {
+
+	// UTF8のBOM付き対応
+	// https://qiita.com/ssc-ynakamura/items/e05dc9bfacee063f3471
+	fallback := unicode.UTF8.NewDecoder()
+	r2 := transform.NewReader(r, unicode.BOMOverride(fallback))
+
+	documentNode, err := html.Parse(r2)
+	if err != nil {
+		return err
+	}
+
+	// h1～h6、td、th、br タグのテキストは前後に半角スペースを付けるので、そのタグを識別するために使用する。
+	// 例えば、 <div>あああ<h1>見出し１</h1>いいい</div> のテキストは「あああ 見出し１ いいい」となる。
+	// h1がspanだった場合 <div>あああ<span>見出し１</span>いいい</div> のテキストは「あああ見出し１いいい」となる。（spanタグの前後にスペースがつかない）
+	patternSpacedTags := "(h[1-6]|td|th|br)"
+	reSpacedTags := regexp.MustCompile(patternSpacedTags)
+
+	// テキスト中のスペースを詰めるためのパターン
+	// アルファベット数字いくつかの記号に挟まれたスペースは残すが、それ以外の文字（ひらがなカタカナ漢字等）
+	// に挟まれたスペースは除外するために使用する。
+	// 有価証券報告書では氏名等がスペースで幅調整されているので、そのスペースを消すために使用する。
+	patternSpaceMidKanjiEtc := `([^0-9０-９a-zA-Zａ-ｚＡ-Ｚ\,\.\!\?\(\)\%])([\s　\xA0]+)([^0-9０-９a-zA-Zａ-ｚＡ-Ｚ\,\.\!\?\(\)\%])`
+	reSpaceMidKanjiEtc := regexp.MustCompile(patternSpaceMidKanjiEtc)
+
+	// 表紙のHTMLかどうか
+	// 最初のHTMLを表紙として扱う。
+	// 表紙のHTMLは目次で区切らない
+	isCoverPage := len(doc.Sections) == 0
+
+	if firstHtmlOfAuditDoc {
+		doc.Sections = append(doc.Sections, Heading{Title: "監査報告書"})
+	} else if isCoverPage {
+		doc.Sections = append(doc.Sections, Heading{Title: "表紙"})
+	}
+
+	var sb strings.Builder
+
+	// HTMLをルートから深さ優先探索していく
+	// 探索しながら目次を見つけたらSectionsにappendしていくことで、目次ごとの文字列を作成する
+	var traverse func(*html.Node)
+	traverse =
+		func(n *html.Node) {
+			if n.Type == html.DocumentNode {
+				for child := n.FirstChild; child != nil; child = child.NextSibling {
+					traverse(child)
+				}
+			} else if n.Type == html.ElementNode {
+				if n.Data == "ix:header" {
+					// InlineXBRLのheaderタグ以下は非表示項目なのでスキップする
+					return
+				}
+				if n.Data == "head" {
+					// headタグ以下は非表示項目なのでスキップする
+					return
+				}
+
+				if isHeading(n) && !isCoverPage {
+					// 【目次】処理。表紙の場合は目次で区切らない。
+					// 目次の直前までのテキストを前の目次のテキストにセット
+					last := &doc.Sections[len(doc.Sections)-1]
+					last.Content = last.Content + " " + sb.String()
+
+					// 新しい目次の処理
+					sb = strings.Builder{}
+					for child := n.FirstChild; child != nil; child = child.NextSibling {
+						traverse(child)
+					}
+					title := sb.String()
+					doc.Sections = append(doc.Sections, Heading{Title: title, Content: title})
+					sb = strings.Builder{}
+				} else {
+					spacing := reSpacedTags.MatchString(n.Data)
+					if spacing {
+						sb.WriteString(" ")
+					}
+					for child := n.FirstChild; child != nil; child = child.NextSibling {
+						traverse(child)
+					}
+					if spacing {
+						sb.WriteString(" ")
+					}
+				}
+			} else if n.Type == html.TextNode {
+				// 日本語文字の間のスペースを除去する
+				// 氏名などで幅調整をスペースでやっている場合を想定
+				// 例：「監 査 法 人」を「監査法人」に
+				s := n.Data
+				for m := reSpaceMidKanjiEtc.MatchString(s); m; m = reSpaceMidKanjiEtc.MatchString(s) {
+					s = reSpaceMidKanjiEtc.ReplaceAllString(s, "$1$3")
+				}
+				sb.WriteString(s)
+			}
+		}
+
+	traverse(documentNode)
+	last := &doc.Sections[len(doc.Sections)-1]
+	last.Content = last.Content + " " + sb.String()
+
+	return nil
+}
+
+// 要素内のテキストを返す
+func innerText(element *html.Node) string {
+	if element.Type == html.TextNode {
+		return element.Data
+	}
+
+	if element.Type == html.ElementNode ||
+		element.Type == html.DocumentNode {
+		var sb strings.Builder
+		for c := element.FirstChild; c != nil; c = c.NextSibling {
+			sb.WriteString(innerText(c))
+		}
+		return sb.String()
+	}
+	return ""
+}
+
+// 目次のパターン
+var reHeading = regexp.MustCompile(`^.{0,5}【(.*)】[\s　\xA0]*$`)
+
+// 目次項目であるかどうか
+func isHeading(element *html.Node) bool {
+	text := innerText(element)
+	matches := reHeading.FindAllString(text, 1)
+	return len(matches) > 0
+}
+
+// Breadcrumb を設定する
+func (doc *ParsedDocument) setBreadcrumb() {
+	var headingTypeStack []int
+	var headingStack []string
+
+	for i, s := range doc.Sections {
+		htype := headingType(s.Title)
+		if htype == 0 {
+			doc.Sections[i].Breadcrumb = s.Title
+			continue
+		}
+
+		for slices.Contains(headingTypeStack, htype) {
+			// 末尾の要素を削除
+			headingTypeStack = headingTypeStack[:len(headingTypeStack)-1]
+			headingStack = headingStack[:len(headingStack)-1]
+		}
+		headingTypeStack = append(headingTypeStack, htype)
+		headingStack = append(headingStack, s.Title)
+
+		var sb strings.Builder
+		sb.WriteString("本文")
+		for _, h := range headingStack {
+			m := reHeading.FindStringSubmatch(h)
+			sb.WriteString(" > " + m[1])
+		}
+		doc.Sections[i].Breadcrumb = sb.String()
+	}
+}
+
+// 目次の種別を判定する
+var reHeadingPrefix = regexp.MustCompile(`^(.*)【`)
+var reHeadingPattern1 = regexp.MustCompile(`第.*部`)
+var reHeadingPattern2 = regexp.MustCompile(`第[0-9０-９]`)
+var reHeadingPattern3 = regexp.MustCompile(`[\(（][0-9０-９]+[\)）]`)
+var reHeadingPattern4 = regexp.MustCompile(`[0-9０-９]`)
+var reHeadingPattern5 = regexp.MustCompile(`[①-⑳]`)
+var reHeadingPattern6 = regexp.MustCompile(`[\(（][ア-ンｱ-ﾝ]+[\)）]`)
+var reHeadingPattern7 = regexp.MustCompile(`[ア-ンｱ-ﾝ]+`)
+var reHeadingPattern8 = regexp.MustCompile(`[\(（][a-zａ-ｚ+[\)）]`)
+var reHeadingPattern9 = regexp.MustCompile(`[a-zａ-ｚ]+`)
+
+func headingType(heading string) int {
+	match := reHeadingPrefix.FindStringSubmatch(heading)
+	if len(match) == 0 {
+		return 0
+	}
+	prefix := match[1]
+	if reHeadingPattern1.MatchString(prefix) {
+		return 1
+	}
+	if reHeadingPattern2.MatchString(prefix) {
+		return 2
+	}
+	if reHeadingPattern3.MatchString(prefix) {
+		return 3
+	}
+	if reHeadingPattern4.MatchString(prefix) {
+		return 4
+	}
+	if reHeadingPattern5.MatchString(prefix) {
+		return 5
+	}
+	if reHeadingPattern6.MatchString(prefix) {
+		return 6
+	}
+	if reHeadingPattern7.MatchString(prefix) {
+		return 7
+	}
+	if reHeadingPattern8.MatchString(prefix) {
+		return 8
+	}
+	if reHeadingPattern9.MatchString(prefix) {
+		return 9
+	}
+	return 99
+}
@@ -0,0 +1,79 @@
+package extractor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// テスト用の書類のzip（表紙、本文2ファイル、監査報告書）
+const testZip = "../testdata/zip/S100TEST.zip"
+
+func TestExtractZip(t *testing.T) {
+	e := Extractor{TempDir: t.TempDir()}
+	doc, err := e.ExtractZip(testZip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		title      string
+		breadcrumb string
+	}{
+		{"表紙", "表紙"},
+		{"第一部【企業情報】", "本文 > 企業情報"},
+		{"第1【企業の概況】", "本文 > 企業情報 > 企業の概況"},
+		{"1【主要な経営指標等の推移】", "本文 > 企業情報 > 企業の概況 > 主要な経営指標等の推移"},
+		{"2【沿革】", "本文 > 企業情報 > 企業の概況 > 沿革"},
+		{"第2【事業の状況】", "本文 > 企業情報 > 事業の状況"},
+		{"1【経営方針、経営環境及び対処すべき課題等】", "本文 > 企業情報 > 事業の状況 > 経営方針、経営環境及び対処すべき課題等"},
+		{"監査報告書", "監査報告書"},
+	}
+	if len(doc.Sections) != len(want) {
+		for _, s := range doc.Sections {
+			t.Logf("%q %q", s.Title, s.Breadcrumb)
+		}
+		t.Fatalf("目次の数 = %d, want %d", len(doc.Sections), len(want))
+	}
+	for i, w := range want {
+		s := doc.Sections[i]
+		if s.Title != w.title || s.Breadcrumb != w.breadcrumb {
+			t.Errorf("Sections[%d] = (%q, %q), want (%q, %q)", i, s.Title, s.Breadcrumb, w.title, w.breadcrumb)
+		}
+	}
+
+	if doc.Version != Version {
+		t.Errorf("Version = %d, want %d", doc.Version, Version)
+	}
+	// 目次のテキストは、見出しから次の見出しの直前まで（連続する空白は1つにする）
+	if got := doc.Sections[3].Content; got != "1【主要な経営指標等の推移】 売上高は増加した。" {
+		t.Errorf("Sections[3].Content = %q", got)
+	}
+	// 表紙は目次で区切らない
+	if got := doc.Sections[0].Content; !strings.Contains(got, "【会社名】 株式会社テスト") {
+		t.Errorf("表紙のテキストに会社名がありません: %q", got)
+	}
+}
+
+func TestExtractZipContextCanceled(t *testing.T) {
+	tempDir := t.TempDir()
+	e := Extractor{TempDir: tempDir}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := e.ExtractZipContext(ctx, testZip)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+
+	// 中断した場合もワークディレクトリは削除する
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("ワークディレクトリが残っています: %v", entries)
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package extractor
 
 // ZIPファイルを解凍する処理
 // 元ネタ
@@ -6,6 +6,7 @@ package main
 
 import (
 	"archive/zip"
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -20,6 +21,11 @@ import (
 // Zipファイルを解凍
 // OS特有のファイル,ディレクトリは解凍対象外(__MACOSX, .DS_Store ..... etc)
 func Unzip(src string, dest string) ([]string, error) {
+	return UnzipContext(context.Background(), src, dest)
+}
+
+// Zipファイルを解凍（ctx がキャンセルされた場合は途中で止めて ctx のエラーを返す）
+func UnzipContext(ctx context.Context, src string, dest string) ([]string, error) {
 	var fileNames []string
 	r, err := zip.OpenReader(src)
 	if err != nil {
@@ -28,6 +34,10 @@ func Unzip(src string, dest string) ([]string, error) {
 	defer r.Close()
 
 	for _, f := range r.File {
+		if err := ctx.Err(); err != nil {
+			return fileNames, err
+		}
+
 		// 不要なファイルは除去
 		if IsExcludedFileOrDir(f.Name) {
 			continue
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"yakumo/edinet"
+)
+
+// fake-edinet: フィクスチャのディレクトリの書類一覧と書類のzipを、EDINET API (v2) と同じ形式で返すHTTPサーバー
+// APIキーやネットワークがなくても sync 等を試せるようにするために使用する
+//
+// フィクスチャのディレクトリの構成
+//
+//	documents/YYYY-MM-DD.json  書類一覧APIのレスポンス（ファイルがない日付は書類0件）
+//	zip/<docID>.zip            書類取得APIの提出本文書及び監査報告書（type=1）
+//	errors.json                エラーを返す日付またはdocIDとステータスコード（省略可。例: {"2024-06-27": 500, "S100ABCD": 404}）
+func runFakeEdinet(args []string) int {
+	fs := newFlagSet("fake-edinet", "")
+	fixtures := fs.String("fixtures", "testdata", "フィクスチャのディレクトリ")
+	addr := fs.String("addr", ":8080", "待ち受けるアドレス")
+	apiKey := fs.String("api-key", "", "受け付けるAPIキー（省略時は空でなければ受け付ける）")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	f, err := newFakeEdinet(*fixtures, *apiKey)
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+
+	log.Printf("http://localhost%s/api/v2 で待ち受けます（フィクスチャ: %s）", *addr, *fixtures)
+	log.Printf("sync 等の -edinet-url（または環境変数 YAKUMO_EDINET_BASE_URL）に指定してください")
+	err = http.ListenAndServe(*addr, f)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	return exitOK
+}
+
+// フィクスチャを返すEDINET API
+type fakeEdinet struct {
+	dir    string
+	apiKey string
+	errors map[string]int // 日付またはdocIDごとに返すエラーのステータスコード
+}
+
+// フィクスチャのディレクトリを確認して fakeEdinet を作成する
+func newFakeEdinet(dir, apiKey string) (*fakeEdinet, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("フィクスチャのディレクトリではありません: %s", dir)
+	}
+
+	f := &fakeEdinet{dir: dir, apiKey: apiKey, errors: make(map[string]int)}
+	b, err := os.ReadFile(filepath.Join(dir, "errors.json"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		err = json.Unmarshal(b, &f.errors)
+		if err != nil {
+			return nil, fmt.Errorf("errors.json: %w", err)
+		}
+	}
+	return f, nil
+}
+
+// 書類取得APIのパスのパターン
+var reFakeDocumentPath = regexp.MustCompile(`^/api/v2/documents/([0-9A-Za-z]+)$`)
+
+func (f *fakeEdinet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL.Path)
+
+	// APIキーの確認は、EDINET APIの手前のゲートウェイと同じ形式で返す
+	key := r.URL.Query().Get("Subscription-Key")
+	if key == "" || (f.apiKey != "" && key != f.apiKey) {
+		writeGatewayError(w, http.StatusUnauthorized, "Access denied due to invalid subscription key. Make sure to provide a valid key for an active subscription.")
+		return
+	}
+
+	if r.URL.Path == "/api/v2/documents.json" {
+		f.serveDocuments(w, r)
+		return
+	}
+	if m := reFakeDocumentPath.FindStringSubmatch(r.URL.Path); m != nil {
+		f.serveDocument(w, r, m[1])
+		return
+	}
+	writeGatewayError(w, http.StatusNotFound, "Resource not found")
+}
+
+// 書類一覧API
+func (f *fakeEdinet) serveDocuments(w http.ResponseWriter, r *http.Request) {
+	date := r.URL.Query().Get("date")
+	typ := r.URL.Query().Get("type")
+	if _, err := time.Parse(dateLayout, date); err != nil || (typ != "" && typ != "1" && typ != "2") {
+		writeMetadataError(w, http.StatusBadRequest, "Bad Request")
+		return
+	}
+	if f.injectError(w, date) {
+		return
+	}
+
+	docs := new(edinet.Documents)
+	b, err := os.ReadFile(filepath.Join(f.dir, "documents", date+".json"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Print(err)
+		writeMetadataError(w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	if err == nil {
+		err = json.Unmarshal(b, docs)
+		if err != nil {
+			log.Printf("%s.json: %v", date, err)
+			writeMetadataError(w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+	}
+
+	// メタデータはリクエストとフィクスチャの内容に合わせる
+	docs.Metadata.Title = "提出された書類を把握するためのAPI"
+	docs.Metadata.Parameter.Date = date
+	docs.Metadata.Parameter.Type = typ
+	if docs.Metadata.Parameter.Type == "" {
+		docs.Metadata.Parameter.Type = "1"
+	}
+	docs.Metadata.Resultset.Count = len(docs.Results)
+	if docs.Metadata.ProcessDateTime == "" {
+		docs.Metadata.ProcessDateTime = date + " 00:00"
+	}
+	docs.Metadata.Status = "200"
+	docs.Metadata.Message = "OK"
+
+	if docs.Metadata.Parameter.Type == "1" {
+		// メタデータのみ
+		writeJSON(w, http.StatusOK, struct {
+			Metadata edinet.Metadata `json:"metadata"`
+		}{docs.Metadata})
+		return
+	}
+	if docs.Results == nil {
+		docs.Results = []edinet.Result{}
+	}
+	writeJSON(w, http.StatusOK, docs)
+}
+
+// 書類取得API
+// フィクスチャは提出本文書及び監査報告書（type=1）のみ
+func (f *fakeEdinet) serveDocument(w http.ResponseWriter, r *http.Request, docID string) {
+	typ := r.URL.Query().Get("type")
+	if len(typ) != 1 || typ[0] < '1' || typ[0] > '5' {
+		writeMetadataError(w, http.StatusBadRequest, "Bad Request")
+		return
+	}
+	if f.injectError(w, docID) {
+		return
+	}
+
+	path := filepath.Join(f.dir, "zip", docID+".zip")
+	if _, err := os.Stat(path); typ != "1" || err != nil {
+		writeMetadataError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, docID))
+	http.ServeFile(w, r, path)
+}
+
+// errors.json に指定された日付またはdocIDならエラーを返す
+func (f *fakeEdinet) injectError(w http.ResponseWriter, key string) bool {
+	status, ok := f.errors[key]
+	if !ok {
+		return false
+	}
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		// ゲートウェイが返すエラー
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "1")
+		}
+		writeGatewayError(w, status, http.StatusText(status))
+	default:
+		writeMetadataError(w, status, http.StatusText(status))
+	}
+	return true
+}
+
+// EDINET APIのエラー（HTTPステータスは200で、metadata.status にステータスコードを返す）
+func writeMetadataError(w http.ResponseWriter, status int, message string) {
+	var body struct {
+		Metadata struct {
+			Title   string `json:"title"`
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		} `json:"metadata"`
+	}
+	body.Metadata.Title = "提出された書類を把握するためのAPI"
+	body.Metadata.Status = fmt.Sprint(status)
+	body.Metadata.Message = message
+	writeJSON(w, http.StatusOK, body)
+}
+
+// ゲートウェイのエラー（HTTPステータスと statusCode、message を返す）
+func writeGatewayError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]any{"statusCode": status, "message": message})
+}
+
+// JSONのレスポンスを返す
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Print(err)
+	}
+}
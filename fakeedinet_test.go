@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// テスト用の書類（testdata/zip/S100TEST.zip）の目次
+var testSections = []string{
+	"表紙",
+	"本文 > 企業情報",
+	"本文 > 企業情報 > 企業の概況",
+	"本文 > 企業情報 > 企業の概況 > 主要な経営指標等の推移",
+	"本文 > 企業情報 > 企業の概況 > 沿革",
+	"本文 > 企業情報 > 事業の状況",
+	"本文 > 企業情報 > 事業の状況 > 経営方針、経営環境及び対処すべき課題等",
+	"監査報告書",
+}
+
+// コマンドの実行に影響する環境変数をテスト用の値にする
+func setTestEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("YAKUMO_EDINET_API_KEY", "test-api-key")
+	t.Setenv("YAKUMO_EDINET_API_KEY_FILE", "")
+	t.Setenv("YAKUMO_ARCHIVE_DIR", "")
+}
+
+// コマンドを実行したSQLiteのデータベースを開く
+func openTestStore(t *testing.T, dsn string) Store {
+	t.Helper()
+	s, err := openStore(dbConfig{dsn: dsn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// スキーマを作成した空のSQLiteのデータベースを開く
+func newTestStore(t *testing.T) Store {
+	t.Helper()
+	s := openTestStore(t, "sqlite://"+filepath.Join(t.TempDir(), "yakumo.db"))
+	err := s.CreateSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// S100TEST が登録され、目次と検索結果がテスト用の書類どおりか確認する
+func checkTestDocument(t *testing.T, s Store) {
+	t.Helper()
+	doc, err := s.FindDocument("S100TEST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc == nil {
+		t.Fatal("S100TEST が登録されていません")
+	}
+	if doc.FilerName != "株式会社テスト" || doc.SeqNumber != 1 {
+		t.Errorf("書類 = (%q, %d), want (株式会社テスト, 1)", doc.FilerName, doc.SeqNumber)
+	}
+
+	chain, err := s.AmendmentChain("S100TEST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 1 {
+		t.Fatalf("訂正の履歴 = %d件, want 1件", len(chain))
+	}
+	sections := chain[0].Sections
+	if len(sections) != len(testSections) {
+		t.Fatalf("目次 = %q, want %q", sections, testSections)
+	}
+	for i, want := range testSections {
+		if sections[i] != want {
+			t.Errorf("目次[%d] = %q, want %q", i, sections[i], want)
+		}
+	}
+
+	hits, err := s.Search(searchOptions{Query: "売上高"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].Breadcrumb != testSections[3] {
+		t.Errorf("検索結果 = %+v, want %q の1件", hits, testSections[3])
+	}
+}
+
+func TestBackfillFromFakeEdinet(t *testing.T) {
+	f, err := newFakeEdinet("testdata", "test-api-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	setTestEnv(t)
+
+	dsn := "sqlite://" + filepath.Join(t.TempDir(), "yakumo.db")
+	code := run([]string{"backfill", "-db", dsn, "-edinet-url", srv.URL + "/api/v2", "-rate", "0",
+		"-from", "2024-06-26", "-to", "2024-06-27"})
+	if code != exitOK {
+		t.Fatalf("終了コード = %d, want %d", code, exitOK)
+	}
+
+	s := openTestStore(t, dsn)
+	checkTestDocument(t, s)
+
+	// 書類がない日付も含めてチェックポイントを記録する
+	from := time.Date(2024, 6, 26, 0, 0, 0, 0, jst)
+	synced, err := s.SyncedDates(from, from.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(synced) != 2 {
+		t.Errorf("チェックポイント = %v, want 2日分", synced)
+	}
+}
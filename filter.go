@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"yakumo/edinet"
+)
+
+// 処理対象の書類を判定するルール
+// 空の項目は条件にしない（どの値でも一致する）
+type filterRule struct {
+	Name          string `json:"name"`          // ルールの名前（ログ出力用）
+	DocTypeCode   string `json:"docTypeCode"`   // 書類種別コード
+	FormCode      string `json:"formCode"`      // 様式コード
+	OrdinanceCode string `json:"ordinanceCode"` // 府令コード
+	FilerType     string `json:"filerType"`     // 提出者の種別（filerTypeCompany、filerTypeFund）
+}
+
+// 提出者の種別
+const (
+	filerTypeCompany = "company" // 会社（ファンドコードなし）
+	filerTypeFund    = "fund"    // ファンド（ファンドコードあり）
+)
+
+// ルールに一致するか
+func (r filterRule) match(result *edinet.Result) bool {
+	if r.DocTypeCode != "" && r.DocTypeCode != result.DocTypeCode {
+		return false
+	}
+	if r.FormCode != "" && r.FormCode != result.FormCode {
+		return false
+	}
+	if r.OrdinanceCode != "" && r.OrdinanceCode != result.OrdinanceCode {
+		return false
+	}
+	switch r.FilerType {
+	case filerTypeCompany:
+		return result.FundCode == ""
+	case filerTypeFund:
+		return result.FundCode != ""
+	}
+	return true
+}
+
+// 処理対象の書類を判定するルールの一覧。いずれかのルールに一致すれば対象とする
+type filterRules []filterRule
+
+// デフォルトのルール（内国法人の有報(3号様式）とその訂正報告書のみ対象）
+var defaultFilterRules = filterRules{
+	{Name: "有価証券報告書", DocTypeCode: "120", FormCode: "030000", OrdinanceCode: "010", FilerType: filerTypeCompany},
+	{Name: "訂正有価証券報告書", DocTypeCode: "130", FormCode: "030001", OrdinanceCode: "010", FilerType: filerTypeCompany},
+}
+
+// いずれかのルールに一致するか
+func (rules filterRules) match(result *edinet.Result) bool {
+	for _, r := range rules {
+		if r.match(result) {
+			return true
+		}
+	}
+	return false
+}
+
+// ルールの検証
+func (rules filterRules) validate() error {
+	if len(rules) == 0 {
+		return fmt.Errorf("ルールが1件もありません")
+	}
+	for i, r := range rules {
+		if r.FilerType != "" && r.FilerType != filerTypeCompany && r.FilerType != filerTypeFund {
+			return fmt.Errorf("%d件目のルールの filerType が不正です: %s", i+1, r.FilerType)
+		}
+	}
+	return nil
+}
+
+// 書類種別コードと名称
+var docTypeNames = map[string]string{
+	"120": "有価証券報告書",
+	"130": "訂正有価証券報告書",
+	"140": "四半期報告書",
+	"150": "訂正四半期報告書",
+	"160": "半期報告書",
+	"170": "訂正半期報告書",
+	"180": "臨時報告書",
+	"190": "訂正臨時報告書",
+	"235": "内部統制報告書",
+	"236": "訂正内部統制報告書",
+}
+
+// 書類種別コードの一覧（コード順）
+func docTypeCodes() []string {
+	codes := make([]string, 0, len(docTypeNames))
+	for code := range docTypeNames {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// カンマ区切りの書類種別コードからルールを作成する
+// 会社が提出した、指定した書類種別の書類を対象とする
+func docTypeRules(codes string) (filterRules, error) {
+	rules := make(filterRules, 0)
+	for _, code := range splitCodes(codes) {
+		name, ok := docTypeNames[code]
+		if !ok {
+			return nil, fmt.Errorf("対応していない書類種別コードです: %s（%s）", code, strings.Join(docTypeCodes(), ","))
+		}
+		rules = append(rules, filterRule{Name: name, DocTypeCode: code, FilerType: filerTypeCompany})
+	}
+	return rules, rules.validate()
+}
+
+// ルールの設定ファイル（JSON）
+//
+//	{
+//	  "rules": [
+//	    {"name": "有価証券報告書", "docTypeCode": "120", "formCode": "030000", "ordinanceCode": "010", "filerType": "company"},
+//	    {"name": "四半期報告書", "docTypeCode": "140", "filerType": "company"}
+//	  ]
+//	}
+type filterConfig struct {
+	Rules filterRules `json:"rules"`
+}
+
+// 設定ファイルからルールを読み込む
+func loadFilterRules(path string) (filterRules, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var conf filterConfig
+	err = json.Unmarshal(b, &conf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	err = conf.Rules.validate()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return conf.Rules, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"yakumo/edinet"
+)
+
+func TestFilterRuleMatch(t *testing.T) {
+	annual := edinet.Result{DocTypeCode: "120", FormCode: "030000", OrdinanceCode: "010"}
+	fund := edinet.Result{DocTypeCode: "120", FormCode: "07A000", OrdinanceCode: "030", FundCode: "G00001"}
+	tests := []struct {
+		name   string
+		rule   filterRule
+		result edinet.Result
+		want   bool
+	}{
+		{"条件なし", filterRule{}, annual, true},
+		{"すべて一致", defaultFilterRules[0], annual, true},
+		{"書類種別が違う", filterRule{DocTypeCode: "130"}, annual, false},
+		{"様式が違う", filterRule{FormCode: "030001"}, annual, false},
+		{"府令が違う", filterRule{OrdinanceCode: "015"}, annual, false},
+		{"会社", filterRule{FilerType: filerTypeCompany}, annual, true},
+		{"会社（ファンド）", filterRule{FilerType: filerTypeCompany}, fund, false},
+		{"ファンド", filterRule{FilerType: filerTypeFund}, fund, true},
+		{"ファンド（会社）", filterRule{FilerType: filerTypeFund}, annual, false},
+		{"ファンドの有報はデフォルトの対象外", defaultFilterRules[0], fund, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.match(&tt.result); got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterRulesMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		result edinet.Result
+		want   bool
+	}{
+		{"有価証券報告書", edinet.Result{DocTypeCode: "120", FormCode: "030000", OrdinanceCode: "010"}, true},
+		{"訂正有価証券報告書", edinet.Result{DocTypeCode: "130", FormCode: "030001", OrdinanceCode: "010"}, true},
+		{"四半期報告書", edinet.Result{DocTypeCode: "140", FormCode: "043000", OrdinanceCode: "010"}, false},
+		{"取り下げられた書類（項目が空）", edinet.Result{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := defaultFilterRules.match(&tt.result); got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if (filterRules{}).match(&tests[0].result) {
+		t.Error("ルールがない場合に一致しました")
+	}
+}
+
+func TestDocTypeRules(t *testing.T) {
+	tests := []struct {
+		codes   string
+		want    filterRules
+		wantErr bool
+	}{
+		{"120", filterRules{{Name: "有価証券報告書", DocTypeCode: "120", FilerType: filerTypeCompany}}, false},
+		{" 120, 140 ,", filterRules{
+			{Name: "有価証券報告書", DocTypeCode: "120", FilerType: filerTypeCompany},
+			{Name: "四半期報告書", DocTypeCode: "140", FilerType: filerTypeCompany},
+		}, false},
+		{"120,999", nil, true},
+		{"", nil, true},
+		{",", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := docTypeRules(tt.codes)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("docTypeRules(%q) のエラー = %v, want エラー %v", tt.codes, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("docTypeRules(%q) = %+v, want %+v", tt.codes, got, tt.want)
+		}
+	}
+}
+
+func TestLoadFilterRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    filterRules
+		wantErr bool
+	}{
+		{
+			name:    "ルール",
+			content: `{"rules": [{"name": "四半期報告書", "docTypeCode": "140", "filerType": "company"}, {"docTypeCode": "120", "formCode": "07A000", "filerType": "fund"}]}`,
+			want: filterRules{
+				{Name: "四半期報告書", DocTypeCode: "140", FilerType: filerTypeCompany},
+				{DocTypeCode: "120", FormCode: "07A000", FilerType: filerTypeFund},
+			},
+		},
+		{name: "JSONが不正", content: `{"rules": [`, wantErr: true},
+		{name: "型が違う", content: `{"rules": {"docTypeCode": "120"}}`, wantErr: true},
+		{name: "ルールがない", content: `{"rules": []}`, wantErr: true},
+		{name: "rules がない", content: `{}`, wantErr: true},
+		{name: "filerType が不正", content: `{"rules": [{"docTypeCode": "120", "filerType": "person"}]}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "filter.json")
+			err := os.WriteFile(path, []byte(tt.content), 0o644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadFilterRules(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("エラー = %v, want エラー %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadFilterRules = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	_, err := loadFilterRules(filepath.Join(t.TempDir(), "none.json"))
+	if err == nil {
+		t.Error("ファイルがない場合のエラーになりません")
+	}
+}
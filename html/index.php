@@ -75,6 +75,14 @@ SELECT M.docid, M.filername, M.docdescription, M.submitdatetime, D.breadcrumb,
         (pgroonga_snippet_html(content,pgroonga_query_extract_keywords (:search_query), 400))[1] AS highlighted_content
 FROM documents M, document_texts D
 WHERE M.docid = D.docid
+-- 取り下げられた書類、不開示の書類は表示しない（yakumo search / serve と同じ条件）
+AND   M.withdrawalstatus IS DISTINCT FROM '2'
+AND   COALESCE(M.disclosurestatus, '0') NOT IN ('1', '3')
+-- 同じdocIDの行が複数ある場合は、書類一覧の日付が最新の行のみ
+AND   NOT EXISTS (
+        SELECT 1 FROM documents N
+        WHERE N.docid = M.docid
+        AND   (N.date > M.date OR (N.date = M.date AND N.seqnumber > M.seqnumber)))
 AND   (:search_query != '' AND D.content &@~ :search_query)
 AND   (:breadcrumb_query = '' OR D.breadcrumb &@~ :breadcrumb_query)
 ORDER BY M.submitdatetime DESC;
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/width"
+
+	"yakumo/extractor"
+)
+
+// import: 手元にある書類のzipを、EDINET APIを使わずに登録する
+// 書類のメタデータは、zipのファイル名・内容と表紙のテキストから作成する
+func runImport(args []string) int {
+	fs := newFlagSet("import", "<ディレクトリ|zip...>")
+	dbf := addDBFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	zipFiles, err := listZipFiles(fs.Args())
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+	if len(zipFiles) == 0 {
+		log.Print("zipファイルがありません")
+		return exitOK
+	}
+
+	s, ok := connectStore(dbf)
+	if !ok {
+		return exitError
+	}
+	defer s.Close()
+
+	err = s.CreateSchema()
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	var ext extractor.Extractor
+	imported, failed, interrupted := 0, 0, 0
+	for _, zipFile := range zipFiles {
+		if ctx.Err() != nil {
+			interrupted++
+			continue
+		}
+		doc, err := importZip(ctx, s, &ext, zipFile)
+		if ctx.Err() != nil {
+			interrupted++
+			continue
+		}
+		if err != nil {
+			log.Printf("%s の登録に失敗: %v", zipFile, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s %s %s／%s／%s\n", doc.DocID, doc.FilerName, doc.DocDescription, formatDateTime(doc.SubmitDateTime), zipFile)
+		imported++
+	}
+	log.Printf("登録の結果: 成功 %d件、失敗 %d件", imported, failed)
+	if interrupted > 0 {
+		log.Printf("中断したため %d件を登録していません（もう一度 yakumo import を実行してください）", interrupted)
+		return exitError
+	}
+
+	if failed > 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+// 引数のzipファイルと、ディレクトリの中（サブディレクトリを含む）のzipファイルの一覧
+func listZipFiles(args []string) ([]string, error) {
+	files := make([]string, 0)
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		err = filepath.WalkDir(arg, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.EqualFold(filepath.Ext(path), ".zip") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// zipからテキストを抽出し、メタデータを作成して保存する
+// 登録済みの書類（sync等で登録した書類）の場合は、メタデータはそのままでテキストを置き換える
+// ctx がキャンセルされた場合は、保存中ならロールバックする
+func importZip(ctx context.Context, s documentStore, ext *extractor.Extractor, zipFile string) (*Document, error) {
+	parsed, err := extractZip(ctx, ext, zipFile)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := documentFromZip(zipFile, parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := s.FindDocument(doc.DocID)
+	if err != nil {
+		return nil, err
+	}
+	if stored != nil {
+		log.Printf("%s は登録済みのため、テキストを置き換えます", doc.DocID)
+		return stored, s.SaveDocument(ctx, stored, parsed)
+	}
+
+	// 書類一覧APIの連番と重ならないよう、負の連番を割り当てる
+	doc.SeqNumber, err = s.NextImportSeqNumber(doc.Date)
+	if err != nil {
+		return nil, err
+	}
+	return doc, s.SaveDocument(ctx, doc, parsed)
+}
+
+// EDINETのzipのファイル名（<docID>.zip）のパターン
+var reDocIDFileName = regexp.MustCompile(`^[A-Z][0-9A-Z]{7}$`)
+
+// zipの中のXBRL等のファイル名に含まれるEDINETコード（例: jpcrp030000-asr-001_E00001-000_2024-03-31_01_2024-06-27.xbrl）
+var reEdinetCodeInFileName = regexp.MustCompile(`_(E\d{5})-\d{3}_`)
+
+// zipの中のXBRL等のファイル名に含まれるタクソノミの略称と様式コード（例: jpcrp030000-asr-001_E00001-000_ の jpcrp と 030000）
+var reFormCodeInFileName = regexp.MustCompile(`(jp[a-z]{3})(\d{6})-[0-9a-z]+-\d{3}_E\d{5}-\d{3}_`)
+
+// タクソノミの略称と府令コード
+var ordinanceCodes = map[string]string{
+	"jpcrp": "010", // 企業内容等の開示に関する内閣府令
+	"jpctl": "015", // 内部統制府令
+	"jpsps": "030", // 特定有価証券の内容等の開示に関する内閣府令
+	"jplvh": "060", // 株券等の大量保有の状況の開示に関する内閣府令
+}
+
+// zipのファイル名・内容と表紙のテキストから書類のメタデータを作成する
+// 書類一覧APIの結果がないため、書類一覧の日付は提出日とし、ステータスは通常（"0"）とする。
+// 訂正報告書の訂正対象の書類（parentDocID）はzipから判定できないため設定しない（訂正の履歴には含まれない）。
+// 同じ書類を後で sync 等で取得すると、書類一覧の情報（parentDocID を含む）に置き換わる
+func documentFromZip(zipFile string, parsed *extractor.ParsedDocument) (*Document, error) {
+	docID := strings.TrimSuffix(filepath.Base(zipFile), filepath.Ext(zipFile))
+	if !reDocIDFileName.MatchString(docID) {
+		return nil, fmt.Errorf("ファイル名（<docID>.zip）から docID を判定できません: %s", filepath.Base(zipFile))
+	}
+	if len(parsed.Sections) == 0 {
+		return nil, fmt.Errorf("表紙がありません")
+	}
+
+	doc := &Document{
+		DocID:             docID,
+		WithdrawalStatus:  "0",
+		DocInfoEditStatus: "0",
+		DisclosureStatus:  "0",
+	}
+
+	// zipの中のファイル名から、EDINETコードとXBRLの有無を判定する
+	r, err := zip.OpenReader(zipFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range r.File {
+		if m := reEdinetCodeInFileName.FindStringSubmatch(f.Name); m != nil && doc.EdinetCode == "" {
+			doc.EdinetCode = m[1]
+		}
+		if m := reFormCodeInFileName.FindStringSubmatch(path.Base(f.Name)); m != nil && doc.FormCode == "" {
+			if code, ok := ordinanceCodes[m[1]]; ok {
+				doc.OrdinanceCode = code
+				doc.FormCode = m[2]
+			}
+		}
+		if strings.HasSuffix(f.Name, ".xbrl") {
+			doc.XbrlFlag = true
+		}
+	}
+	r.Close()
+
+	// 表紙の項目
+	cover := coverPageItems(parsed.Sections[0].Content)
+	doc.DocDescription = cover["提出書類"]
+	for code, name := range docTypeNames {
+		if name == doc.DocDescription {
+			doc.DocTypeCode = code
+		}
+	}
+	doc.FilerName = cover["会社名"]
+	if doc.FilerName == "" {
+		doc.FilerName = cover["発行者名"]
+	}
+
+	submitted, ok := parseJapaneseDate(cover["提出日"])
+	if !ok {
+		return nil, fmt.Errorf("表紙から提出日を判定できません")
+	}
+	doc.SubmitDateTime = submitted
+	doc.Date = submitted
+
+	// 事業年度、四半期会計期間、中間会計期間等の（自 ～ 至 ～）
+	for label, value := range cover {
+		if !strings.Contains(label, "年度") && !strings.Contains(label, "期間") {
+			continue
+		}
+		if m := rePeriod.FindStringSubmatch(value); m != nil {
+			doc.PeriodStart, _ = parseJapaneseDate(m[1])
+			doc.PeriodEnd, _ = parseJapaneseDate(m[2])
+			break
+		}
+	}
+	return doc, nil
+}
+
+// 表紙の【項目名】と値のパターン
+var reCoverPageItem = regexp.MustCompile(`【([^】]+)】\s*([^【]*)`)
+
+// 表紙のテキストから【項目名】ごとの値を取得する（最初に現れた値を使用する）
+// 全角の英数字は半角にする（半角カナは全角にする）
+func coverPageItems(content string) map[string]string {
+	items := make(map[string]string)
+	for _, m := range reCoverPageItem.FindAllStringSubmatch(width.Fold.String(content), -1) {
+		label := strings.TrimSpace(m[1])
+		if _, ok := items[label]; !ok {
+			items[label] = strings.TrimSpace(m[2])
+		}
+	}
+	return items
+}
+
+// 日付（西暦または令和、平成）のパターン
+const japaneseDatePattern = `(?:令和|平成)?\s*(?:\d+|元)\s*年\s*\d+\s*月\s*\d+\s*日`
+
+var (
+	reJapaneseDate = regexp.MustCompile(`(令和|平成)?\s*(\d+|元)\s*年\s*(\d+)\s*月\s*(\d+)\s*日`)
+	rePeriod       = regexp.MustCompile(`自\s*(` + japaneseDatePattern + `)\s*至\s*(` + japaneseDatePattern + `)`)
+)
+
+// 元号の元年の前年（西暦）
+var eraOffsets = map[string]int{"令和": 2018, "平成": 1988}
+
+// 「2024年6月27日」「令和6年6月27日」形式の日付を解釈する
+// 元号がない場合は西暦（4桁）とする。存在しない日付（2月30日等）は解釈できないものとする
+func parseJapaneseDate(s string) (time.Time, bool) {
+	m := reJapaneseDate.FindStringSubmatch(s)
+	if m == nil {
+		return time.Time{}, false
+	}
+	if m[1] == "" && len(m[2]) != 4 {
+		// 対応していない元号（昭和等）や「元年」のみ
+		return time.Time{}, false
+	}
+	year := 1
+	if m[2] != "元" {
+		year, _ = strconv.Atoi(m[2])
+	}
+	year += eraOffsets[m[1]]
+	month, _ := strconv.Atoi(m[3])
+	day, _ := strconv.Atoi(m[4])
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, jst)
+	if t.Year() != year || int(t.Month()) != month || t.Day() != day {
+		return time.Time{}, false
+	}
+	return t, true
+}
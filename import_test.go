@@ -0,0 +1,133 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"yakumo/extractor"
+)
+
+func TestParseJapaneseDate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // 解釈できない場合は空
+	}{
+		{"2024年6月27日", "2024-06-27"},
+		{"令和6年6月27日", "2024-06-27"},
+		{"令和 6 年 6 月 27 日", "2024-06-27"},
+		{"令和元年5月1日", "2019-05-01"},
+		{"平成31年3月31日", "2019-03-31"},
+		{"第10期（自 2023年4月1日", "2023-04-01"},
+		{"2024年2月29日", "2024-02-29"},
+		{"2023年2月29日", ""},
+		{"2024年2月30日", ""},
+		{"2024年13月1日", ""},
+		{"2024年0月1日", ""},
+		{"2024年6月0日", ""},
+		{"昭和60年1月1日", ""},
+		{"元年5月1日", ""},
+		{"6年6月27日", ""},
+		{"2024/06/27", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got, ok := parseJapaneseDate(tt.in)
+		if tt.want == "" {
+			if ok {
+				t.Errorf("parseJapaneseDate(%q) = %s, want 解釈できない", tt.in, got.Format(dateLayout))
+			}
+			continue
+		}
+		if !ok || got.Format(dateLayout) != tt.want || got.Location() != jst {
+			t.Errorf("parseJapaneseDate(%q) = (%s, %v), want %s", tt.in, got, ok, tt.want)
+		}
+	}
+}
+
+func TestCoverPageItems(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+	}{
+		{
+			name:    "全角の英数字は半角にする",
+			content: "【表紙】 【提出書類】 有価証券報告書 【提出日】 令和６年６月２７日 【会社名】 株式会社ＡＢＣ",
+			want:    map[string]string{"表紙": "", "提出書類": "有価証券報告書", "提出日": "令和6年6月27日", "会社名": "株式会社ABC"},
+		},
+		{
+			name:    "最初に現れた値を使用する",
+			content: "【会社名】 株式会社テスト 【会社名】 株式会社別名",
+			want:    map[string]string{"会社名": "株式会社テスト"},
+		},
+		{
+			name:    "半角カナは全角にする",
+			content: "【会社名】 ﾃｽﾄ",
+			want:    map[string]string{"会社名": "テスト"},
+		},
+		{
+			name:    "項目なし",
+			content: "表紙",
+			want:    map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := coverPageItems(tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("coverPageItems = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocumentFromZip(t *testing.T) {
+	var ext extractor.Extractor
+	parsed, err := ext.ExtractZip("testdata/zip/S100TEST.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := documentFromZip("testdata/zip/S100TEST.zip", parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := func(s string) time.Time {
+		d, err := time.ParseInLocation(dateLayout, s, jst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	want := &Document{
+		Date:              date("2024-06-27"),
+		DocID:             "S100TEST",
+		EdinetCode:        "E99999",
+		FilerName:         "株式会社テスト",
+		OrdinanceCode:     "010",
+		FormCode:          "030000",
+		DocTypeCode:       "120",
+		PeriodStart:       date("2023-04-01"),
+		PeriodEnd:         date("2024-03-31"),
+		SubmitDateTime:    date("2024-06-27"),
+		DocDescription:    "有価証券報告書",
+		WithdrawalStatus:  "0",
+		DocInfoEditStatus: "0",
+		DisclosureStatus:  "0",
+		XbrlFlag:          true,
+	}
+	if !reflect.DeepEqual(doc, want) {
+		t.Errorf("documentFromZip = %+v\nwant %+v", doc, want)
+	}
+
+	// ファイル名が docID でない
+	_, err = documentFromZip("testdata/zip/sample.zip", parsed)
+	if err == nil {
+		t.Error("ファイル名が docID でない zip のエラーになりません")
+	}
+	// 表紙がない
+	_, err = documentFromZip("testdata/zip/S100TEST.zip", &extractor.ParsedDocument{})
+	if err == nil {
+		t.Error("表紙がない zip のエラーになりません")
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// スキーマのマイグレーション
+// migrations ディレクトリ（SQLiteは migrations/sqlite ディレクトリ）の
+// NNNN_名前.up.sql（適用）と NNNN_名前.down.sql（取り消し）をバージョン順に実行し、
+// 適用済みのバージョンを schema_migrations テーブルに記録する
+
+//go:embed migrations/*.sql migrations/sqlite/*.sql
+var migrationFiles embed.FS
+
+// マイグレーション
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// マイグレーションのファイル名のパターン
+var reMigrationFile = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// 埋め込んだマイグレーションをバージョン順に取得する
+func loadMigrations(dir string) ([]migration, error) {
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		m := reMigrationFile.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("マイグレーションのファイル名が不正です: %s", e.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		b, err := migrationFiles.ReadFile(path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &migration{version: version, name: m[2]}
+			byVersion[version] = mig
+		}
+		if m[3] == "up" {
+			mig.up = string(b)
+		} else {
+			mig.down = string(b)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("マイグレーション %04d_%s の up または down がありません", m.version, m.name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+// 適用済みのマイグレーション
+type appliedMigration struct {
+	version   int
+	name      string
+	appliedAt time.Time
+}
+
+// 適用済みのマイグレーションをバージョン順に取得する（schema_migrations テーブルがなければ作成する）
+func appliedMigrations(db *sql.DB) ([]appliedMigration, error) {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version int NOT NULL,
+			name text NOT NULL,
+			appliedAt timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (version)
+		)`)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT version, name, appliedAt FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make([]appliedMigration, 0)
+	for rows.Next() {
+		var a appliedMigration
+		err = rows.Scan(&a.version, &a.name, &a.appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		applied = append(applied, a)
+	}
+	return applied, rows.Err()
+}
+
+// データベースのスキーマがこのプログラムより新しい場合のエラー
+type newerSchemaError struct {
+	current int
+	latest  int
+}
+
+func (e *newerSchemaError) Error() string {
+	return fmt.Sprintf("データベースのスキーマ（バージョン %d）がこのプログラムの対応するバージョン（%d）より新しいため処理できません。yakumo を更新してください", e.current, e.latest)
+}
+
+// 適用済みのバージョンのうち、このプログラムが知らないものがあればエラーを返す
+func checkSchemaVersion(migrations []migration, applied []appliedMigration) error {
+	known := make(map[int]bool)
+	latest := 0
+	for _, m := range migrations {
+		known[m.version] = true
+		latest = m.version
+	}
+	for _, a := range applied {
+		if !known[a.version] {
+			return &newerSchemaError{current: applied[len(applied)-1].version, latest: latest}
+		}
+	}
+	return nil
+}
+
+// マイグレーションを1つ実行する
+func runMigration(db *sql.DB, m migration, up bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if up {
+		_, err = tx.Exec(m.up)
+		if err == nil {
+			_, err = tx.Exec(`INSERT INTO schema_migrations(version, name) VALUES($1, $2)`, m.version, m.name)
+		}
+	} else {
+		_, err = tx.Exec(m.down)
+		if err == nil {
+			_, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, m.version)
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("マイグレーション %04d_%s: %w", m.version, m.name, err)
+	}
+	return tx.Commit()
+}
+
+// 未適用のマイグレーションを target のバージョンまで適用する（target が0以下ならすべて）
+// 適用したマイグレーションの数を返す
+func (s *sqlStore) MigrateUp(target int) (int, error) {
+	migrations, err := loadMigrations(s.migrationDir)
+	if err != nil {
+		return 0, err
+	}
+	applied, err := appliedMigrations(s.db)
+	if err != nil {
+		return 0, err
+	}
+	err = checkSchemaVersion(migrations, applied)
+	if err != nil {
+		return 0, err
+	}
+
+	done := make(map[int]bool)
+	for _, a := range applied {
+		done[a.version] = true
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if done[m.version] || (target > 0 && m.version > target) {
+			continue
+		}
+		log.Printf("マイグレーション %04d_%s を適用します", m.version, m.name)
+		err = runMigration(s.db, m, true)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// 適用済みのマイグレーションを新しいものから steps 個取り消す
+// 取り消したマイグレーションの数を返す
+func (s *sqlStore) MigrateDown(steps int) (int, error) {
+	migrations, err := loadMigrations(s.migrationDir)
+	if err != nil {
+		return 0, err
+	}
+	applied, err := appliedMigrations(s.db)
+	if err != nil {
+		return 0, err
+	}
+	err = checkSchemaVersion(migrations, applied)
+	if err != nil {
+		return 0, err
+	}
+
+	byVersion := make(map[int]migration)
+	for _, m := range migrations {
+		byVersion[m.version] = m
+	}
+
+	count := 0
+	for i := len(applied) - 1; i >= 0 && count < steps; i-- {
+		m := byVersion[applied[i].version]
+		log.Printf("マイグレーション %04d_%s を取り消します", m.version, m.name)
+		err = runMigration(s.db, m, false)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// マイグレーションの状態
+type migrationState struct {
+	version   int
+	name      string
+	applied   bool
+	appliedAt time.Time
+	unknown   bool // データベースには適用済みだが、このプログラムが知らないマイグレーション
+}
+
+// マイグレーションの状態をバージョン順に取得する
+func (s *sqlStore) MigrationStatus() ([]migrationState, error) {
+	migrations, err := loadMigrations(s.migrationDir)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make(map[int]*migrationState)
+	for _, m := range migrations {
+		states[m.version] = &migrationState{version: m.version, name: m.name}
+	}
+	for _, a := range applied {
+		st, ok := states[a.version]
+		if !ok {
+			st = &migrationState{version: a.version, name: a.name, unknown: true}
+			states[a.version] = st
+		}
+		st.applied = true
+		st.appliedAt = a.appliedAt
+	}
+
+	list := make([]migrationState, 0, len(states))
+	for _, st := range states {
+		list = append(list, *st)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].version < list[j].version })
+	return list, nil
+}
+
+// 起動時のスキーマのチェック
+// データベースのスキーマがこのプログラムより新しい場合はエラーにし、未適用のマイグレーションがあれば適用する
+func (s *sqlStore) CreateSchema() error {
+	count, err := s.MigrateUp(0)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		log.Printf("%d件のマイグレーションを適用しました", count)
+	}
+	return nil
+}
+
+// 起動時のスキーマのチェック（マイグレーションは適用しない）
+// データベースのスキーマがこのプログラムより新しい場合、または未適用のマイグレーションがある場合はエラーを返す
+func (s *sqlStore) CheckSchema() error {
+	migrations, err := loadMigrations(s.migrationDir)
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(s.db)
+	if err != nil {
+		return err
+	}
+	err = checkSchemaVersion(migrations, applied)
+	if err != nil {
+		return err
+	}
+	if len(applied) < len(migrations) {
+		return fmt.Errorf("未適用のマイグレーションがあります。yakumo migrate up を実行してください")
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckSchemaVersion(t *testing.T) {
+	migrations := []migration{{version: 1}, {version: 2}, {version: 3}}
+	applied := func(versions ...int) []appliedMigration {
+		a := make([]appliedMigration, 0, len(versions))
+		for _, v := range versions {
+			a = append(a, appliedMigration{version: v})
+		}
+		return a
+	}
+	tests := []struct {
+		name    string
+		applied []appliedMigration
+		want    *newerSchemaError // nil ならエラーにならない
+	}{
+		{"未適用", applied(), nil},
+		{"一部を適用済み", applied(1, 2), nil},
+		{"すべて適用済み", applied(1, 2, 3), nil},
+		{"新しいバージョンを適用済み", applied(1, 2, 3, 4), &newerSchemaError{current: 4, latest: 3}},
+		{"知らないバージョンが途中にある", applied(1, 5), &newerSchemaError{current: 5, latest: 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSchemaVersion(migrations, tt.applied)
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("err = %v, want nil", err)
+				}
+				return
+			}
+			var ne *newerSchemaError
+			if !errors.As(err, &ne) || *ne != *tt.want {
+				t.Errorf("err = %v, want %+v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	for _, dir := range []string{"migrations", "migrations/sqlite"} {
+		migrations, err := loadMigrations(dir)
+		if err != nil {
+			t.Fatalf("%s: %v", dir, err)
+		}
+		if len(migrations) == 0 {
+			t.Fatalf("%s: マイグレーションがありません", dir)
+		}
+		for i, m := range migrations {
+			if m.version != i+1 {
+				t.Errorf("%s: %d番目のバージョン = %d, want %d", dir, i+1, m.version, i+1)
+			}
+		}
+	}
+}
+
+// 適用済みのバージョンの一覧
+func appliedVersions(t *testing.T, s Store) []int {
+	t.Helper()
+	states, err := s.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions := make([]int, 0)
+	for _, st := range states {
+		if st.applied {
+			versions = append(versions, st.version)
+		}
+	}
+	return versions
+}
+
+func TestMigrateSQLite(t *testing.T) {
+	migrations, err := loadMigrations("migrations/sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := len(migrations)
+	s := openTestStore(t, "sqlite://"+filepath.Join(t.TempDir(), "yakumo.db"))
+
+	// 空のデータベースは未適用のマイグレーションがある
+	if err := s.CheckSchema(); err == nil {
+		t.Error("CheckSchema が未適用のマイグレーションのエラーになりません")
+	}
+
+	steps := []struct {
+		name      string
+		migrate   func() (int, error)
+		wantCount int
+		wantLast  int // 適用済みの最新のバージョン（0は未適用）
+	}{
+		{"バージョン1まで適用", func() (int, error) { return s.MigrateUp(1) }, 1, 1},
+		{"すべて適用", func() (int, error) { return s.MigrateUp(0) }, latest - 1, latest},
+		{"適用済みなら何もしない", func() (int, error) { return s.MigrateUp(0) }, 0, latest},
+		{"1つ取り消す", func() (int, error) { return s.MigrateDown(1) }, 1, latest - 1},
+		{"すべて取り消す", func() (int, error) { return s.MigrateDown(latest + 1) }, latest - 1, 0},
+		{"取り消した後に適用し直す", func() (int, error) { return s.MigrateUp(0) }, latest, latest},
+	}
+	for _, st := range steps {
+		count, err := st.migrate()
+		if err != nil {
+			t.Fatalf("%s: %v", st.name, err)
+		}
+		if count != st.wantCount {
+			t.Errorf("%s: 件数 = %d, want %d", st.name, count, st.wantCount)
+		}
+		versions := appliedVersions(t, s)
+		if len(versions) != st.wantLast || (st.wantLast > 0 && versions[len(versions)-1] != st.wantLast) {
+			t.Errorf("%s: 適用済み = %v, want %d まで", st.name, versions, st.wantLast)
+		}
+	}
+	if err := s.CheckSchema(); err != nil {
+		t.Errorf("CheckSchema = %v, want nil", err)
+	}
+
+	// このプログラムより新しいスキーマは、適用も取り消しもしない
+	_, err = s.(*sqliteStore).db.Exec(`INSERT INTO schema_migrations(version, name) VALUES(9999, 'future')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ne *newerSchemaError
+	if err := s.CheckSchema(); !errors.As(err, &ne) {
+		t.Errorf("CheckSchema = %v, want newerSchemaError", err)
+	}
+	if _, err := s.MigrateUp(0); !errors.As(err, &ne) {
+		t.Errorf("MigrateUp = %v, want newerSchemaError", err)
+	}
+	if _, err := s.MigrateDown(1); !errors.As(err, &ne) {
+		t.Errorf("MigrateDown = %v, want newerSchemaError", err)
+	}
+	if v := appliedVersions(t, s); len(v) != latest+1 {
+		t.Errorf("適用済み = %v, want 変更なし", v)
+	}
+}
@@ -0,0 +1,7 @@
+-- 初期スキーマの削除（登録済みのデータはすべて削除される）
+
+DROP TABLE IF EXISTS document_status_log;
+DROP TABLE IF EXISTS failed_documents;
+DROP TABLE IF EXISTS sync_state;
+DROP TABLE IF EXISTS document_texts;
+DROP TABLE IF EXISTS documents;
@@ -0,0 +1,95 @@
+-- 初期スキーマ
+-- スキーマのバージョン管理を導入する前（createTableAndIndex で作成していた）データベースにも
+-- 適用できるよう、すべて IF NOT EXISTS で作成し、後から追加した列は ALTER TABLE で追加する
+
+CREATE TABLE IF NOT EXISTS documents (
+	date char(10) NOT NULL,
+	seqNumber int NOT NULL,
+	docID char(8) NOT NULL,
+	submitDateTime char(16) NULL,
+	edinetCode char(6) NULL,
+	secCode char(5) NULL,
+	filerName text NULL,
+	periodStart  char(10) NULL,
+	periodEnd char(10) NULL,
+	docDescription text NULL,
+	PRIMARY KEY (date, seqNumber)
+);
+
+-- 書類種別コード（追加した列。追加前に登録した書類はすべて有報）
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS docTypeCode char(3) NULL;
+UPDATE documents SET docTypeCode = '120' WHERE docTypeCode IS NULL;
+
+-- 訂正報告書の場合、訂正対象の書類のdocID（追加した列）
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS parentDocID char(8) NULL;
+
+-- 取下区分、書類情報修正区分、開示不開示区分（追加した列。追加前に登録した書類は通常）
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS withdrawalStatus char(1) NULL;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS docInfoEditStatus char(1) NULL;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS disclosureStatus char(1) NULL;
+UPDATE documents SET withdrawalStatus = '0' WHERE withdrawalStatus IS NULL;
+UPDATE documents SET docInfoEditStatus = '0' WHERE docInfoEditStatus IS NULL;
+UPDATE documents SET disclosureStatus = '0' WHERE disclosureStatus IS NULL;
+
+-- 書類一覧APIのその他の項目（追加した列）
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS jcn char(13) NULL;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS fundCode char(6) NULL;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS ordinanceCode char(3) NULL;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS formCode char(6) NULL;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS issuerEdinetCode char(6) NULL;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS subjectEdinetCode char(6) NULL;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS subsidiaryEdinetCode text NULL;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS currentReportReason text NULL;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS opeDateTime timestamp NULL;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS xbrlFlag boolean NULL;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS pdfFlag boolean NULL;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS attachDocFlag boolean NULL;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS englishDocFlag boolean NULL;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS csvFlag boolean NULL;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS legalStatus char(1) NULL;
+CREATE INDEX IF NOT EXISTS documents_docid_index ON documents (docID);
+CREATE INDEX IF NOT EXISTS documents_jcn_index ON documents (jcn);
+
+-- ステータスの変更履歴
+CREATE TABLE IF NOT EXISTS document_status_log (
+	id serial NOT NULL,
+	docID char(8) NOT NULL,
+	field text NOT NULL,
+	oldValue char(1) NULL,
+	newValue char(1) NULL,
+	opeDateTime char(16) NULL,
+	action text NOT NULL,
+	recordedAt timestamp NOT NULL DEFAULT now(),
+	PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS document_texts (
+	docID char(8) NOT NULL,
+	seq int NOT NULL,
+	title text NOT NULL,
+	breadcrumb text NOT NULL,
+	content text NOT NULL,
+	PRIMARY KEY (docID, seq)
+);
+
+CREATE TABLE IF NOT EXISTS sync_state (
+	date char(10) NOT NULL,
+	processDateTime char(16) NULL,
+	documentCount int NOT NULL,
+	syncedAt timestamp NOT NULL DEFAULT now(),
+	PRIMARY KEY (date)
+);
+
+CREATE TABLE IF NOT EXISTS failed_documents (
+	docID char(8) NOT NULL,
+	date char(10) NOT NULL,
+	stage text NOT NULL,
+	error text NOT NULL,
+	attempts int NOT NULL,
+	lastAttemptAt timestamp NOT NULL,
+	result text NOT NULL,
+	PRIMARY KEY (docID)
+);
+
+CREATE EXTENSION IF NOT EXISTS pgroonga;
+CREATE INDEX IF NOT EXISTS pgroonga_content_index ON document_texts USING pgroonga (breadcrumb, content);
@@ -0,0 +1,24 @@
+-- 日付、日時の列を文字列に戻す
+
+ALTER TABLE document_status_log
+	ALTER COLUMN opeDateTime TYPE char(16) USING to_char(opeDateTime AT TIME ZONE 'Asia/Tokyo', 'YYYY-MM-DD HH24:MI'),
+	ALTER COLUMN recordedAt TYPE timestamp;
+
+ALTER TABLE failed_documents
+	ALTER COLUMN date TYPE char(10) USING to_char(date, 'YYYY-MM-DD'),
+	ALTER COLUMN lastAttemptAt TYPE timestamp;
+
+ALTER TABLE sync_state
+	ALTER COLUMN date TYPE char(10) USING to_char(date, 'YYYY-MM-DD'),
+	ALTER COLUMN processDateTime TYPE char(16) USING to_char(processDateTime AT TIME ZONE 'Asia/Tokyo', 'YYYY-MM-DD HH24:MI'),
+	ALTER COLUMN syncedAt TYPE timestamp;
+
+DROP INDEX IF EXISTS documents_submitdatetime_index;
+
+ALTER TABLE documents
+	ALTER COLUMN date TYPE char(10) USING to_char(date, 'YYYY-MM-DD'),
+	ALTER COLUMN submitDateTime TYPE char(16) USING to_char(submitDateTime AT TIME ZONE 'Asia/Tokyo', 'YYYY-MM-DD HH24:MI'),
+	ALTER COLUMN periodStart TYPE char(10) USING to_char(periodStart, 'YYYY-MM-DD'),
+	ALTER COLUMN periodEnd TYPE char(10) USING to_char(periodEnd, 'YYYY-MM-DD'),
+	ALTER COLUMN opeDateTime TYPE timestamp USING opeDateTime AT TIME ZONE 'Asia/Tokyo',
+	ALTER COLUMN secCode TYPE char(5);
@@ -0,0 +1,25 @@
+-- 日付、日時の列を文字列から date、timestamptz に変更する
+-- EDINET APIの日時は日本時間なので、Asia/Tokyo として変換する。空の値はNULLにする
+
+ALTER TABLE documents
+	ALTER COLUMN date TYPE date USING date::date,
+	ALTER COLUMN submitDateTime TYPE timestamptz USING NULLIF(trim(submitDateTime), '')::timestamp AT TIME ZONE 'Asia/Tokyo',
+	ALTER COLUMN periodStart TYPE date USING NULLIF(trim(periodStart), '')::date,
+	ALTER COLUMN periodEnd TYPE date USING NULLIF(trim(periodEnd), '')::date,
+	ALTER COLUMN opeDateTime TYPE timestamptz USING opeDateTime AT TIME ZONE 'Asia/Tokyo',
+	ALTER COLUMN secCode TYPE varchar(5) USING NULLIF(trim(secCode), '');
+
+CREATE INDEX IF NOT EXISTS documents_submitdatetime_index ON documents (submitDateTime);
+
+ALTER TABLE sync_state
+	ALTER COLUMN date TYPE date USING date::date,
+	ALTER COLUMN processDateTime TYPE timestamptz USING NULLIF(trim(processDateTime), '')::timestamp AT TIME ZONE 'Asia/Tokyo',
+	ALTER COLUMN syncedAt TYPE timestamptz;
+
+ALTER TABLE failed_documents
+	ALTER COLUMN date TYPE date USING date::date,
+	ALTER COLUMN lastAttemptAt TYPE timestamptz;
+
+ALTER TABLE document_status_log
+	ALTER COLUMN opeDateTime TYPE timestamptz USING NULLIF(trim(opeDateTime), '')::timestamp AT TIME ZONE 'Asia/Tokyo',
+	ALTER COLUMN recordedAt TYPE timestamptz;
@@ -0,0 +1 @@
+ALTER TABLE document_texts DROP COLUMN extractor_version;
@@ -0,0 +1,3 @@
+-- 目次ごとのテキストを抽出した処理のバージョン（extractor.Version）
+-- 追加前に登録したテキストは不明（NULL）とする
+ALTER TABLE document_texts ADD COLUMN extractor_version int NULL;
@@ -0,0 +1,9 @@
+-- アーカイブに保存した書類のzip
+CREATE TABLE archived_files (
+	docID char(8) NOT NULL,
+	path text NOT NULL,
+	sha256 char(64) NOT NULL,
+	size bigint NOT NULL,
+	archivedAt timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (docID)
+);
@@ -0,0 +1,11 @@
+-- SQLite の初期スキーマを削除する
+
+DROP TRIGGER IF EXISTS document_texts_au;
+DROP TRIGGER IF EXISTS document_texts_ad;
+DROP TRIGGER IF EXISTS document_texts_ai;
+DROP TABLE IF EXISTS document_texts_fts;
+DROP TABLE IF EXISTS failed_documents;
+DROP TABLE IF EXISTS sync_state;
+DROP TABLE IF EXISTS document_texts;
+DROP TABLE IF EXISTS document_status_log;
+DROP TABLE IF EXISTS documents;
@@ -0,0 +1,100 @@
+-- SQLite の初期スキーマ（PostgreSQL の migrations/0001～0002 を適用した状態と同じ列）
+-- 全文検索には FTS5 の trigram トークナイザーを使用する
+
+CREATE TABLE documents (
+	date date NOT NULL,
+	seqNumber int NOT NULL,
+	docID char(8) NOT NULL,
+	submitDateTime timestamp NULL,
+	edinetCode char(6) NULL,
+	secCode varchar(5) NULL,
+	filerName text NULL,
+	periodStart date NULL,
+	periodEnd date NULL,
+	docDescription text NULL,
+	docTypeCode char(3) NULL,
+	parentDocID char(8) NULL,
+	withdrawalStatus char(1) NULL,
+	docInfoEditStatus char(1) NULL,
+	disclosureStatus char(1) NULL,
+	jcn char(13) NULL,
+	fundCode char(6) NULL,
+	ordinanceCode char(3) NULL,
+	formCode char(6) NULL,
+	issuerEdinetCode char(6) NULL,
+	subjectEdinetCode char(6) NULL,
+	subsidiaryEdinetCode text NULL,
+	currentReportReason text NULL,
+	opeDateTime timestamp NULL,
+	xbrlFlag boolean NULL,
+	pdfFlag boolean NULL,
+	attachDocFlag boolean NULL,
+	englishDocFlag boolean NULL,
+	csvFlag boolean NULL,
+	legalStatus char(1) NULL,
+	PRIMARY KEY (date, seqNumber)
+);
+CREATE INDEX documents_docid_index ON documents (docID);
+CREATE INDEX documents_jcn_index ON documents (jcn);
+CREATE INDEX documents_submitdatetime_index ON documents (submitDateTime);
+
+-- ステータスの変更履歴
+CREATE TABLE document_status_log (
+	id INTEGER PRIMARY KEY,
+	docID char(8) NOT NULL,
+	field text NOT NULL,
+	oldValue char(1) NULL,
+	newValue char(1) NULL,
+	opeDateTime timestamp NULL,
+	action text NOT NULL,
+	recordedAt timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- id は全文検索インデックスの行と対応させるための列
+CREATE TABLE document_texts (
+	id INTEGER PRIMARY KEY,
+	docID char(8) NOT NULL,
+	seq int NOT NULL,
+	title text NOT NULL,
+	breadcrumb text NOT NULL,
+	content text NOT NULL,
+	UNIQUE (docID, seq)
+);
+
+CREATE TABLE sync_state (
+	date date NOT NULL,
+	processDateTime timestamp NULL,
+	documentCount int NOT NULL,
+	syncedAt timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (date)
+);
+
+CREATE TABLE failed_documents (
+	docID char(8) NOT NULL,
+	date date NOT NULL,
+	stage text NOT NULL,
+	error text NOT NULL,
+	attempts int NOT NULL,
+	lastAttemptAt timestamp NOT NULL,
+	result text NOT NULL,
+	PRIMARY KEY (docID)
+);
+
+-- 目次と本文の全文検索インデックス（document_texts を参照する外部コンテンツテーブル）
+CREATE VIRTUAL TABLE document_texts_fts USING fts5(
+	breadcrumb, content,
+	content = 'document_texts', content_rowid = 'id',
+	tokenize = 'trigram'
+);
+
+-- document_texts の変更を全文検索インデックスに反映する
+CREATE TRIGGER document_texts_ai AFTER INSERT ON document_texts BEGIN
+	INSERT INTO document_texts_fts(rowid, breadcrumb, content) VALUES (new.id, new.breadcrumb, new.content);
+END;
+CREATE TRIGGER document_texts_ad AFTER DELETE ON document_texts BEGIN
+	INSERT INTO document_texts_fts(document_texts_fts, rowid, breadcrumb, content) VALUES ('delete', old.id, old.breadcrumb, old.content);
+END;
+CREATE TRIGGER document_texts_au AFTER UPDATE ON document_texts BEGIN
+	INSERT INTO document_texts_fts(document_texts_fts, rowid, breadcrumb, content) VALUES ('delete', old.id, old.breadcrumb, old.content);
+	INSERT INTO document_texts_fts(rowid, breadcrumb, content) VALUES (new.id, new.breadcrumb, new.content);
+END;
@@ -0,0 +1,2 @@
+-- 目次ごとのテキストを抽出した処理のバージョン（extractor.Version）
+ALTER TABLE document_texts ADD COLUMN extractor_version int NULL;
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"yakumo/edinet"
+	"yakumo/extractor"
+)
+
+// パイプラインの設定
+type pipelineConfig struct {
+	downloadWorkers  int           // ダウンロードの並列数
+	extractWorkers   int           // テキスト抽出の並列数
+	rateLimit        float64       // EDINET APIへの1秒あたりの最大リクエスト数（0以下は無制限）
+	retries          int           // EDINET APIのリクエストが失敗した場合のリトライ回数
+	requestTimeout   time.Duration // EDINET APIの1回のリクエストのタイムアウト
+	breakerThreshold int           // EDINET APIのリクエストを止めるまでの連続失敗回数（0は止めない）
+	filter           filterRules   // 処理対象の書類を判定するルール
+	archiveDir       string        // 書類のzipのアーカイブのディレクトリ（空ならアーカイブしない）
+	edinetURL        string        // EDINET APIのベースURL
+	recordDir        string        // EDINET APIのレスポンスを記録するディレクトリ（空なら記録しない）
+	replayDir        string        // EDINET APIの代わりにレスポンスを再生するディレクトリ（空なら再生しない）
+}
+
+// デフォルトのパイプライン設定
+var defaultPipelineConfig = pipelineConfig{
+	downloadWorkers:  4,
+	extractWorkers:   2,
+	rateLimit:        2,
+	retries:          edinet.DefaultRetryPolicy.MaxAttempts - 1,
+	requestTimeout:   edinet.DefaultRetryPolicy.RequestTimeout,
+	breakerThreshold: edinet.DefaultBreakerThreshold,
+	filter:           defaultFilterRules,
+}
+
+// パイプラインが使用するデータベースの役割
+type pipelineStore interface {
+	documentStore
+	syncStateStore
+	failureStore
+	archiveStore
+}
+
+// 書類を取得して登録するパイプライン
+type pipeline struct {
+	cfg     pipelineConfig
+	store   pipelineStore
+	client  *edinet.Client // EDINET APIのクライアント
+	archive *zipArchive    // 書類のzipのアーカイブ（nil ならアーカイブを使用しない）
+}
+
+// パイプラインを作成する。EDINET APIのクライアントは設定に合わせて作成する
+// クライアントを作成できなければ（APIキーがない等）ログに出力して false を返す
+func newPipeline(s pipelineStore, cfg pipelineConfig) (*pipeline, bool) {
+	client, ok := setupEdinetClient(cfg)
+	if !ok {
+		return nil, false
+	}
+	return &pipeline{cfg: cfg, store: s, client: client, archive: newZipArchive(cfg.archiveDir, s)}, true
+}
+
+// パイプラインで処理する1書類分のジョブ
+type job struct {
+	index   int                       // 書類一覧での順番（保存順を決める）
+	result  edinet.Result             // 書類一覧APIの結果
+	zipFile string                    // ダウンロードしたzipのパス
+	keepZip bool                      // zipがアーカイブのファイルなので削除しない
+	doc     *extractor.ParsedDocument // 抽出したテキスト
+	stage   string                    // エラーが発生したステージ
+	err     error                     // 途中のステージで発生したエラー
+}
+
+// ステージ名（failed_documents.stage に記録する）
+const (
+	stageDownload = "download"
+	stageExtract  = "extract"
+	stageStore    = "store"
+)
+
+// パイプラインの処理結果
+type pipelineResult struct {
+	saved       int // 保存できた書類数
+	failed      int // 失敗した書類数
+	interrupted int // 中断したため処理しなかった書類数（failed_documents には記録しない）
+}
+
+// 処理結果を足し合わせる
+func (r *pipelineResult) add(o pipelineResult) {
+	r.saved += o.saved
+	r.failed += o.failed
+	r.interrupted += o.interrupted
+}
+
+// 書類一覧から取得した書類を 一覧 → ダウンロード → 抽出 → 保存 のステージで処理する
+// ダウンロードと抽出はそれぞれのワーカー数で並列に処理するが、
+// 保存は一覧の順番どおりに1件ずつ行うため、結果は逐次処理と同じになる。
+// 書類ごとのエラーは failed_documents テーブルに記録して、次の書類の処理を続ける。
+// ctx がキャンセルされた場合は新しい書類の処理を始めず、処理中の書類は中断して（保存中ならロールバックして）、
+// 一時ファイルを削除してから戻る
+// failed_documents テーブルに記録できない等、データベースのエラーの場合は同様に処理を中断してそのエラーを返す
+func (p *pipeline) processDocuments(ctx context.Context, date string, results []edinet.Result) (pipelineResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan *job)
+	downloaded := make(chan *job, p.cfg.extractWorkers)
+	extracted := make(chan *job, p.cfg.extractWorkers)
+
+	// 処理中（一覧に投入してから保存が終わるまで）の書類数の上限
+	// 保存待ちの書類がリトライ等で止まっている間に、後の書類の抽出結果がメモリに溜まり続けないようにする
+	inFlight := make(chan struct{}, p.cfg.downloadWorkers+p.cfg.extractWorkers)
+
+	// 一覧
+	go func() {
+		defer close(jobs)
+		for i, r := range results {
+			select {
+			case inFlight <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- &job{index: i, result: r}:
+			case <-ctx.Done():
+				<-inFlight
+				return
+			}
+		}
+	}()
+
+	// ダウンロード（アーカイブにあればアーカイブのzipを使用する）
+	var wgDownload sync.WaitGroup
+	for i := 0; i < p.cfg.downloadWorkers; i++ {
+		wgDownload.Add(1)
+		go func() {
+			defer wgDownload.Done()
+			for j := range jobs {
+				j.zipFile, j.keepZip, j.err = p.fetchZip(ctx, j.result)
+				if j.err != nil {
+					j.stage = stageDownload
+				}
+				downloaded <- j
+			}
+		}()
+	}
+	go func() {
+		wgDownload.Wait()
+		close(downloaded)
+	}()
+
+	// 抽出
+	var ext extractor.Extractor
+	var wgExtract sync.WaitGroup
+	for i := 0; i < p.cfg.extractWorkers; i++ {
+		wgExtract.Add(1)
+		go func() {
+			defer wgExtract.Done()
+			for j := range downloaded {
+				if j.err == nil {
+					j.doc, j.err = extractZip(ctx, &ext, j.zipFile)
+					if j.err != nil {
+						j.stage = stageExtract
+					}
+				}
+				if j.zipFile != "" && !j.keepZip {
+					os.Remove(j.zipFile)
+				}
+				extracted <- j
+			}
+		}()
+	}
+	go func() {
+		wgExtract.Wait()
+		close(extracted)
+	}()
+
+	// 保存（一覧の順番どおりにコミットする）
+	var res pipelineResult
+	var storeErr error
+	pending := make(map[int]*job)
+	next := 0
+	for j := range extracted {
+		pending[j.index] = j
+		for {
+			pj, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			if ctx.Err() != nil {
+				// 中断した書類は失敗として記録せず、次回に処理する
+				res.interrupted++
+				<-inFlight
+				next++
+				continue
+			}
+			saved, err := p.storeJob(ctx, date, pj)
+			switch {
+			case err != nil:
+				// 失敗を記録できなかった書類も次回に処理する。残りの書類は中断する
+				storeErr = err
+				cancel()
+				res.interrupted++
+			case saved:
+				res.saved++
+			case ctx.Err() != nil:
+				// 保存中に中断した書類（ロールバックしたので次回に処理する）
+				res.interrupted++
+			default:
+				res.failed++
+			}
+			<-inFlight
+			next++
+		}
+	}
+	// 一覧のうち、中断したためジョブにしなかった書類
+	res.interrupted += len(results) - next
+	return res, storeErr
+}
+
+// 書類のzipを用意する。アーカイブにあればそのパスを返す（keep が true）
+// なければダウンロードし、アーカイブを使用する場合はアーカイブに保存してそのパスを返す
+func (p *pipeline) fetchZip(ctx context.Context, result edinet.Result) (zipFile string, keep bool, err error) {
+	if p.archive != nil {
+		zipFile, ok, err := p.archive.Lookup(result.DocID)
+		if err != nil {
+			return "", false, err
+		}
+		if ok {
+			return zipFile, true, nil
+		}
+	}
+
+	tempFile, err := p.downloadToTemp(ctx, result)
+	if err != nil || p.archive == nil {
+		return tempFile, false, err
+	}
+	defer os.Remove(tempFile)
+	zipFile, err = p.archive.Put(result.DocID, tempFile)
+	if err != nil {
+		return "", false, fmt.Errorf("アーカイブへの保存に失敗: %w", err)
+	}
+	return zipFile, true, nil
+}
+
+// Result データから、そのデータのzipをtempファイルにダウンロードする
+// 失敗した場合も、作成したtempファイルのパスを返す（呼び出し側で削除する）
+func (p *pipeline) downloadToTemp(ctx context.Context, result edinet.Result) (string, error) {
+	// tempファイルを作成するだけして閉じる
+	tempFile, err := os.CreateTemp(os.TempDir(), "edinet_*.zip")
+	if err != nil {
+		return "", err
+	}
+	tempFile.Close()
+	tempFileName := tempFile.Name()
+
+	// 作成したtempファイルを上書きするようにzipをダウンロードする
+	err = DownloadZip(ctx, p.client, result.DocID, tempFileName)
+	if err != nil {
+		return tempFileName, err
+	}
+	return tempFileName, nil
+}
+
+// zipファイルからテキストを抽出する
+// 想定外のHTMLでパニックした場合もエラーとして扱い、処理全体は止めない
+func extractZip(ctx context.Context, ext *extractor.Extractor, zipFile string) (doc *extractor.ParsedDocument, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("テキスト抽出中にパニック: %v", r)
+		}
+	}()
+	return ext.ExtractZipContext(ctx, zipFile)
+}
+
+// 抽出したテキストをデータベースに保存する。保存できた場合はtrueを返す
+// 失敗した場合は failed_documents テーブルに記録する。記録できなかった場合はそのエラーを返す
+// 保存中に ctx がキャンセルされた場合はロールバックし、失敗としては記録しない
+func (p *pipeline) storeJob(ctx context.Context, date string, j *job) (bool, error) {
+	if j.err == nil {
+		var doc *Document
+		doc, j.err = newDocument(date, &j.result)
+		if j.err == nil {
+			j.err = p.store.SaveDocument(ctx, doc, j.doc)
+		}
+		if j.err != nil {
+			j.stage = stageStore
+		}
+	}
+
+	if j.err != nil && ctx.Err() != nil {
+		log.Printf("%s %s の保存を中断しました（ロールバックしました）", date, j.result.DocID)
+		return false, nil
+	}
+	if j.err != nil {
+		log.Printf("%s %s の処理に失敗（%s）: %v", date, j.result.DocID, j.stage, j.err)
+		err := p.store.RecordFailure(date, j.result, j.stage, j.err)
+		if err != nil {
+			return false, fmt.Errorf("failed_documents への記録に失敗: %w", err)
+		}
+		return false, nil
+	}
+
+	_, err := p.store.ClearFailure(j.result.DocID)
+	if err != nil {
+		return false, fmt.Errorf("failed_documents の削除に失敗: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"yakumo/edinet"
+	"yakumo/extractor"
+)
+
+// SaveDocument の開始時に ctx をキャンセルする（保存中の中断）
+type cancelOnSaveStore struct {
+	pipelineStore
+	cancel context.CancelFunc
+}
+
+func (s cancelOnSaveStore) SaveDocument(ctx context.Context, doc *Document, parsed *extractor.ParsedDocument) error {
+	s.cancel()
+	return s.pipelineStore.SaveDocument(ctx, doc, parsed)
+}
+
+func TestProcessDocumentsCancel(t *testing.T) {
+	tests := []struct {
+		name string
+		// 中断のしかた。テスト用のEDINET APIのハンドラと、パイプラインが使用するデータベースを返す
+		setup func(cancel context.CancelFunc, f http.Handler, s Store) (http.Handler, pipelineStore)
+	}{
+		{"開始前に中断", func(cancel context.CancelFunc, f http.Handler, s Store) (http.Handler, pipelineStore) {
+			cancel()
+			return f, s
+		}},
+		{"ダウンロード中に中断", func(cancel context.CancelFunc, f http.Handler, s Store) (http.Handler, pipelineStore) {
+			// zipの途中まで返したところで中断する
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !strings.HasPrefix(r.URL.Path, "/api/v2/documents/") {
+					f.ServeHTTP(w, r)
+					return
+				}
+				w.Header().Set("Content-Type", "application/octet-stream")
+				w.Write([]byte("PK\x03\x04"))
+				w.(http.Flusher).Flush()
+				cancel()
+				<-r.Context().Done()
+			}), s
+		}},
+		{"保存中に中断", func(cancel context.CancelFunc, f http.Handler, s Store) (http.Handler, pipelineStore) {
+			return f, cancelOnSaveStore{pipelineStore: s, cancel: cancel}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t)
+			fake, err := newFakeEdinet(writeTestFixtures(t, strings.NewReplacer()), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// ダウンロードと抽出の一時ファイルを作成するディレクトリ
+			tempDir := t.TempDir()
+			t.Setenv("TMPDIR", tempDir)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			handler, ps := tt.setup(cancel, fake, s)
+			srv := httptest.NewServer(handler)
+			defer srv.Close()
+
+			c := newEdinetClient()
+			c.APIKey = "test-api-key"
+			c.BaseURL = srv.URL + "/api/v2"
+			c.Retry.MaxAttempts = 1
+			c.Breaker = nil
+			p := &pipeline{cfg: defaultPipelineConfig, store: ps, client: c}
+
+			res, err := p.processDocuments(ctx, "2024-06-27", []edinet.Result{testResult(t)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res != (pipelineResult{interrupted: 1}) {
+				t.Errorf("処理結果 = %+v, want 未処理1件", res)
+			}
+
+			// 保存も失敗の記録もしない（次回に処理する）
+			doc, err := s.FindDocument("S100TEST")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if doc != nil {
+				t.Error("中断した書類が保存されています")
+			}
+			hits, err := s.Search(searchOptions{Query: "売上高"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(hits) != 0 {
+				t.Errorf("中断した書類のテキストが保存されています: %+v", hits)
+			}
+			failed, err := s.FailedDocuments()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(failed) != 0 {
+				t.Errorf("failed_documents = %+v, want なし", failed)
+			}
+
+			// 一時ファイルは残らない
+			entries, err := os.ReadDir(tempDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range entries {
+				t.Errorf("一時ファイルが残っています: %s", e.Name())
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"yakumo/extractor"
+)
+
+// 再抽出の対象の条件
+type reextractOptions struct {
+	DocID            string    // docIDを指定する（空なら指定しない）
+	Since            time.Time // 書類一覧の日付がこの日以降の書類（ゼロ値なら指定しない）
+	OlderThanVersion int       // このバージョンより前の抽出処理で登録した書類（0なら指定しない）
+}
+
+// reextract: アーカイブ（または指定したディレクトリ）のzipから現在の抽出処理でテキストを抽出し直して、登録済みのテキストを置き換える
+func runReextract(args []string) int {
+	fs := newFlagSet("reextract", "")
+	dbf := addDBFlags(fs)
+	docID := fs.String("doc", "", "対象の書類のdocID")
+	sinceStr := fs.String("since", "", "書類一覧の日付がこの日以降の書類を対象にする（YYYY-MM-DD）")
+	olderThan := fs.Int("older-than-version", 0, fmt.Sprintf("このバージョンより前の抽出処理で登録した書類を対象にする（現在のバージョンは %d）", extractor.Version))
+	archiveDir := fs.String("archive", os.Getenv("YAKUMO_ARCHIVE_DIR"), "書類のzipのアーカイブのディレクトリ（省略時は環境変数 YAKUMO_ARCHIVE_DIR）")
+	zipDir := fs.String("zip-dir", "", "アーカイブの代わりに、書類のzip（<docID>.zip）を保存してあるディレクトリを使用する")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if *archiveDir == "" && *zipDir == "" {
+		fmt.Fprintln(os.Stderr, "yakumo reextract: -archive または -zip-dir を指定してください")
+		fs.Usage()
+		return exitUsage
+	}
+	if *olderThan < 0 {
+		fmt.Fprintln(os.Stderr, "yakumo reextract: -older-than-version には0以上を指定してください")
+		return exitUsage
+	}
+	opts := reextractOptions{DocID: *docID, OlderThanVersion: *olderThan}
+	if *sinceStr != "" {
+		var err error
+		opts.Since, err = parseDate(*sinceStr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "yakumo reextract: -since の日付が不正です: %s\n", *sinceStr)
+			return exitUsage
+		}
+	}
+
+	s, ok := connectStore(dbf)
+	if !ok {
+		return exitError
+	}
+	defer s.Close()
+
+	err := s.CreateSchema()
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+
+	docIDs, err := s.ReextractTargets(opts)
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+	if len(docIDs) == 0 {
+		log.Print("再抽出する書類はありません")
+		return exitOK
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	arc := newZipArchive(*archiveDir, s)
+	var ext extractor.Extractor
+	var updated, unchanged, missing, failed, interrupted int
+	for _, id := range docIDs {
+		if ctx.Err() != nil {
+			interrupted++
+			continue
+		}
+
+		zipFile, found, err := localZip(arc, *zipDir, id)
+		if err != nil {
+			log.Printf("%s zipの確認に失敗: %v", id, err)
+			failed++
+			continue
+		}
+		if !found {
+			log.Printf("%s zipがありません", id)
+			missing++
+			continue
+		}
+
+		parsed, err := extractZip(ctx, &ext, zipFile)
+		if ctx.Err() != nil {
+			interrupted++
+			continue
+		}
+		if err != nil {
+			log.Printf("%s テキストの抽出に失敗: %v", id, err)
+			failed++
+			continue
+		}
+		changed, err := s.ReplaceSections(id, parsed)
+		if err != nil {
+			log.Printf("%s テキストの保存に失敗: %v", id, err)
+			failed++
+			continue
+		}
+
+		fmt.Printf("%s 目次 %d件、変更 %d件\n", id, len(parsed.Sections), changed)
+		if changed > 0 {
+			updated++
+		} else {
+			unchanged++
+		}
+	}
+	log.Printf("再抽出の結果: 変更あり %d件、変更なし %d件、zipなし %d件、失敗 %d件", updated, unchanged, missing, failed)
+	if interrupted > 0 {
+		log.Printf("中断したため %d件を再抽出していません（もう一度 yakumo reextract を実行してください）", interrupted)
+		return exitError
+	}
+
+	if failed > 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+// 手元にある書類のzipのパスを返す
+// zipDir を指定した場合はそのディレクトリの <docID>.zip、それ以外はアーカイブ（記録と一致するもの）を使用する
+func localZip(arc *zipArchive, zipDir string, docID string) (string, bool, error) {
+	if zipDir != "" {
+		zipFile := filepath.Join(zipDir, docID+".zip")
+		_, err := os.Stat(zipFile)
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		return zipFile, err == nil, err
+	}
+	return arc.Lookup(docID)
+}
+
+// 登録済みの目次と抽出し直した目次を順に比べて、内容が変わった目次の数を返す
+// 目次の数が変わった場合、増減した分も変更として数える
+func changedSections(before, after []extractor.Heading) int {
+	changed := 0
+	for i := 0; i < len(before) || i < len(after); i++ {
+		if i >= len(before) || i >= len(after) || before[i] != after[i] {
+			changed++
+		}
+	}
+	return changed
+}
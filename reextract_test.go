@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"yakumo/extractor"
+)
+
+func TestChangedSections(t *testing.T) {
+	a := extractor.Heading{Title: "1【沿革】", Breadcrumb: "本文 > 沿革", Content: "1990年 設立"}
+	b := extractor.Heading{Title: "2【事業の内容】", Breadcrumb: "本文 > 事業の内容", Content: "製造業"}
+	c := extractor.Heading{Title: "3【関係会社の状況】", Breadcrumb: "本文 > 関係会社の状況", Content: "子会社 3社"}
+	modified := b
+	modified.Content = "製造業、小売業"
+	retitled := b
+	retitled.Breadcrumb = "本文 > 企業情報 > 事業の内容"
+
+	tests := []struct {
+		name          string
+		before, after []extractor.Heading
+		want          int
+	}{
+		{"変更なし", []extractor.Heading{a, b}, []extractor.Heading{a, b}, 0},
+		{"テキストの変更", []extractor.Heading{a, b}, []extractor.Heading{a, modified}, 1},
+		{"目次の変更", []extractor.Heading{a, b}, []extractor.Heading{a, retitled}, 1},
+		{"追加", []extractor.Heading{a, b}, []extractor.Heading{a, b, c}, 1},
+		{"削除", []extractor.Heading{a, b, c}, []extractor.Heading{a}, 2},
+		{"途中に挿入すると後の目次も変更になる", []extractor.Heading{a, b}, []extractor.Heading{a, c, b}, 2},
+		{"登録済みのテキストなし", nil, []extractor.Heading{a, b}, 2},
+		{"どちらもなし", nil, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := changedSections(tt.before, tt.after); got != tt.want {
+				t.Errorf("changedSections = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplaceSections(t *testing.T) {
+	s := newTestStore(t)
+	saveTestDocument(t, s, newZipArchive(t.TempDir(), s))
+
+	ext := extractor.Extractor{TempDir: t.TempDir()}
+	parsed, err := ext.ExtractZip("testdata/zip/S100TEST.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 同じzipから抽出し直しても変更はない
+	changed, err := s.ReplaceSections("S100TEST", parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != 0 {
+		t.Errorf("変更 = %d件, want 0件", changed)
+	}
+
+	// 抽出結果が変わった目次のテキストを置き換える
+	parsed.Sections[3].Content = "1【主要な経営指標等の推移】 営業収益は増加した。"
+	changed, err = s.ReplaceSections("S100TEST", parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != 1 {
+		t.Errorf("変更 = %d件, want 1件", changed)
+	}
+	for query, want := range map[string]int{"売上高": 0, "営業収益": 1} {
+		hits, err := s.Search(searchOptions{Query: query})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hits) != want {
+			t.Errorf("%s の検索結果 = %d件, want %d件", query, len(hits), want)
+		}
+	}
+}
+
+func TestLocalZip(t *testing.T) {
+	s := newTestStore(t)
+	arc := newZipArchive(t.TempDir(), s)
+	saveTestDocument(t, s, arc)
+
+	zipDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(zipDir, "S100ABCD.zip"), []byte("zip"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		zipDir   string
+		docID    string
+		want     string
+		wantFind bool
+	}{
+		{"アーカイブ", "", "S100TEST", filepath.Join(arc.dir, "TE", "ST", "S100TEST.zip"), true},
+		{"アーカイブにない", "", "S100ABCD", "", false},
+		{"ディレクトリ", zipDir, "S100ABCD", filepath.Join(zipDir, "S100ABCD.zip"), true},
+		{"ディレクトリにない（アーカイブは使用しない）", zipDir, "S100TEST", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found, err := localZip(arc, tt.zipDir, tt.docID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || found != tt.wantFind {
+				t.Errorf("localZip = (%q, %v), want (%q, %v)", got, found, tt.want, tt.wantFind)
+			}
+		})
+	}
+}
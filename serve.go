@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+)
+
+// serve: 検索画面をHTTPで提供する
+func runServe(args []string) int {
+	fs := newFlagSet("serve", "")
+	dbf := addDBFlags(fs)
+	addr := fs.String("addr", ":8000", "待ち受けるアドレス")
+	limit := fs.Int("limit", 200, "表示する最大件数（0は無制限）")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	s, ok := connectStore(dbf)
+	if !ok {
+		return exitError
+	}
+	defer s.Close()
+
+	err := s.CheckSchema()
+	if err != nil {
+		log.Print(err)
+		return exitError
+	}
+
+	http.HandleFunc("/", searchHandler(s, *limit))
+	http.HandleFunc("/amendments", amendmentsHandler(s))
+	log.Printf("http://localhost%s/ で待ち受けます", *addr)
+	err = http.ListenAndServe(*addr, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	return exitOK
+}
+
+// 検索結果を書類ごとにまとめたもの
+type searchGroup struct {
+	SearchHit
+	Hits []SearchHit
+}
+
+// 検索画面に渡すデータ
+type searchPage struct {
+	Query       string
+	Breadcrumb  string
+	DocType     string
+	DocTypes    []docTypeOption
+	AllVersions bool
+	From        string // 提出日の範囲（YYYY-MM-DD）
+	To          string
+	Oldest      bool // 提出日時の古い順に並べる
+	Groups      []searchGroup
+	Error       string
+}
+
+// 書類種別の選択肢
+type docTypeOption struct {
+	Code     string
+	Name     string
+	Selected bool
+}
+
+// 検索画面のハンドラ
+func searchHandler(s searchStore, limit int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" && r.URL.Path != "/index.php" {
+			http.NotFound(w, r)
+			return
+		}
+
+		page := searchPage{
+			Query:       r.FormValue("q"),
+			Breadcrumb:  r.FormValue("b"),
+			DocType:     r.FormValue("t"),
+			AllVersions: r.FormValue("all") != "",
+			From:        r.FormValue("from"),
+			To:          r.FormValue("to"),
+			Oldest:      r.FormValue("sort") == "old",
+		}
+		for _, code := range docTypeCodes() {
+			page.DocTypes = append(page.DocTypes, docTypeOption{Code: code, Name: docTypeNames[code], Selected: code == page.DocType})
+		}
+
+		if page.Query != "" {
+			opts := searchOptions{
+				Query:       page.Query,
+				Breadcrumb:  page.Breadcrumb,
+				DocTypes:    splitCodes(page.DocType),
+				AllVersions: page.AllVersions,
+				Oldest:      page.Oldest,
+				Limit:       limit,
+			}
+			// 解釈できない日付は無視する
+			opts.From, _ = parseDate(page.From)
+			opts.To, _ = parseDate(page.To)
+			hits, err := s.Search(opts)
+			if err != nil {
+				log.Print(err)
+				page.Error = "検索に失敗しました"
+			}
+			for _, h := range hits {
+				if len(page.Groups) == 0 || page.Groups[len(page.Groups)-1].DocID != h.DocID {
+					page.Groups = append(page.Groups, searchGroup{SearchHit: h})
+				}
+				g := &page.Groups[len(page.Groups)-1]
+				g.Hits = append(g.Hits, h)
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err := searchTemplate.Execute(w, page)
+		if err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+// 訂正の履歴画面のハンドラ
+func amendmentsHandler(s searchStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		chain, err := s.AmendmentChain(r.FormValue("doc"))
+		if err != nil {
+			log.Print(err)
+			http.Error(w, "訂正の履歴の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		if len(chain) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err = amendmentsTemplate.Execute(w, chain)
+		if err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+// スニペットのHTMLタグを除去してテキストにする
+var reTag = regexp.MustCompile(`<[^>]*>`)
+
+func snippetToText(snippet string) string {
+	return html.UnescapeString(reTag.ReplaceAllString(snippet, ""))
+}
+
+// 検索画面のテンプレート（html/index.php と同じ見た目）
+var searchTemplate = template.Must(template.New("search").Funcs(template.FuncMap{
+	// pgroonga_snippet_html はエスケープ済みのHTMLを返すのでそのまま出力する
+	"snippet":  func(s string) template.HTML { return template.HTML(s) },
+	"datetime": formatDateTime,
+}).Parse(`<!DOCTYPE html>
+<html lang="ja">
+<head>
+    <meta charset="UTF-8">
+    <title>有価証券報告書 全文検索</title>
+    <link href="https://unpkg.com/@primer/css@^20.2.4/dist/primer.css" rel="stylesheet" />
+    <style>
+        span.keyword{
+            color:red;
+            font-weight:bold;
+        }
+    </style>
+</head>
+<body>
+{{if eq .Query ""}}
+    <div class="container-sm text-center p-6">
+        <form action="/" method="GET">
+            <header>
+                <h1>有価証券報告書 全文検索</h1>
+            </header>
+            <input class="mt-5 mb-5 form-control input-block" type="text" name="q" size="60" placeholder="検索キーワードを入力" value="">
+            <input type="submit" class="btn btn-primary" value="検索">
+        </form>
+    </div>
+{{else}}
+    <div class="container-sm text-center">
+        <form action="/" method="GET">
+            <header>
+                <h1>有価証券報告書 全文検索</h1>
+            </header>
+            <input class="mt-5 mb-1 form-control input-block" type="text" name="q" size="60" placeholder="検索キーワードを入力" value="{{.Query}}">
+            <input class="mb-1 form-control input-block" type="text" name="b" size="60" placeholder="目次で絞り込み" value="{{.Breadcrumb}}">
+            <select class="mb-1 form-select input-block" name="t">
+                <option value="">すべての書類種別</option>
+                {{- range .DocTypes}}
+                <option value="{{.Code}}"{{if .Selected}} selected{{end}}>{{.Name}}</option>
+                {{- end}}
+            </select>
+            <div class="d-flex flex-items-center mb-1">
+                <input class="form-control" type="date" name="from" value="{{.From}}" aria-label="提出日（から）">
+                <span class="mx-2">～</span>
+                <input class="form-control" type="date" name="to" value="{{.To}}" aria-label="提出日（まで）">
+                <select class="form-select ml-2" name="sort">
+                    <option value="new"{{if not .Oldest}} selected{{end}}>新しい順</option>
+                    <option value="old"{{if .Oldest}} selected{{end}}>古い順</option>
+                </select>
+            </div>
+            <label class="d-block mb-5"><input type="checkbox" name="all" value="1"{{if .AllVersions}} checked{{end}}> 訂正前の目次も表示する</label>
+            <input type="submit" class="btn btn-primary" value="検索">
+        </form>
+    </div>
+    <div class="container-lg p-6">
+    {{- if .Error}}
+        {{.Error}}
+    {{- else}}
+    {{- range .Groups}}
+        <div class="container-md mt-4 border color-border-accent p-2 rounded mb-2">
+            <div class="text-bold f2"><a target="_blank" href="https://disclosure2.edinet-fsa.go.jp/WZEK0040.aspx?{{.DocID}}">{{.FilerName}}</a></div>
+            <div class="f6 color-fg-subtle">{{.DocDescription}}／{{datetime .SubmitDateTime}}</div>
+            {{- if .Amended}}
+            <div class="f6 color-fg-attention">訂正報告書が提出されています（<a href="/amendments?doc={{.DocID}}">訂正の履歴</a>）</div>
+            {{- end}}
+            {{- range .Hits}}
+            <div class="container-md mt-2 border color-border-accent p-2 rounded mb-2">
+                <div class="f6 color-fg-subtle">{{.Breadcrumb}}</div>
+                <div class="container-lg mt-2 f5">{{snippet .Snippet}}</div>
+            </div>
+            {{- end}}
+        </div>
+    {{- else}}
+        一致する結果がありませんでした
+    {{- end}}
+    {{- end}}
+    </div>
+{{end}}
+</body>
+</html>
+`))
+
+// 訂正の履歴画面のテンプレート
+var amendmentsTemplate = template.Must(template.New("amendments").Funcs(template.FuncMap{"datetime": formatDateTime}).Parse(`<!DOCTYPE html>
+<html lang="ja">
+<head>
+    <meta charset="UTF-8">
+    <title>訂正の履歴</title>
+    <link href="https://unpkg.com/@primer/css@^20.2.4/dist/primer.css" rel="stylesheet" />
+</head>
+<body>
+    <div class="container-lg p-6">
+        <h1>訂正の履歴</h1>
+    {{- range $i, $c := .}}
+        <div class="container-md mt-4 border color-border-accent p-2 rounded mb-2">
+            <div class="text-bold f3"><a target="_blank" href="https://disclosure2.edinet-fsa.go.jp/WZEK0040.aspx?{{$c.DocID}}">{{$c.FilerName}}</a></div>
+            <div class="f6 color-fg-subtle">{{$c.DocID}}／{{$c.DocDescription}}／{{datetime $c.SubmitDateTime}}</div>
+            {{- if $i}}
+            <div class="mt-2 f5">訂正された目次:</div>
+            <ul class="ml-4 f6">
+            {{- range $c.Corrected}}
+                <li>{{.}}</li>
+            {{- else}}
+                <li>なし（訂正箇所は本文を参照）</li>
+            {{- end}}
+            </ul>
+            {{- end}}
+        </div>
+    {{- end}}
+    </div>
+</body>
+</html>
+`))
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf8"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteの接続文字列の接頭辞（sqlite:///path/yakumo.db）
+const sqliteScheme = "sqlite://"
+
+// SQLiteを使用する Store
+// Dockerやデータベースサーバーを用意せず、ローカルのファイルだけで動かす場合に使用する
+type sqliteStore struct {
+	sqlStore
+}
+
+// SQLiteのデータベースファイルを開く（なければ作成する）
+func openSQLite(cfg dbConfig) (*sqliteStore, error) {
+	path := strings.TrimPrefix(cfg.dsn, sqliteScheme)
+	if path == "" {
+		return nil, fmt.Errorf("SQLiteのファイルのパスを指定してください（例: sqlite:///path/yakumo.db）")
+	}
+
+	// 日時は "2006-01-02 15:04:05+09:00" の形式で保存する（同じタイムゾーンなら文字列の順と日時の順が一致する）
+	db, err := sql.Open("sqlite", "file:"+path+
+		"?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_time_format=sqlite")
+	if err != nil {
+		return nil, err
+	}
+	// SQLiteの書き込みは1接続ずつなので、接続数は1にする
+	db.SetMaxOpenConns(1)
+
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteStore{sqlStore{db: db, migrationDir: "migrations/sqlite"}}, nil
+}
+
+// 全文検索インデックスを再構築する
+func (s *sqliteStore) Reindex() error {
+	_, err := s.db.Exec(`INSERT INTO document_texts_fts(document_texts_fts) VALUES ('rebuild')`)
+	return err
+}
+
+// 一括登録モードを開始する
+// SQLiteでは全文検索インデックスの更新の負荷が小さいため、なにもしない
+func (s *sqliteStore) BeginBulkLoad() error {
+	return nil
+}
+
+// 一括登録モードを終了する
+func (s *sqliteStore) EndBulkLoad() error {
+	return nil
+}
+
+// trigram トークナイザーで検索できるキーワードの最小の文字数
+// これより短いキーワードは LIKE で検索する
+const trigramMinLength = 3
+
+// 全文検索する（pgStore.Search と同じ条件）
+// キーワードは空白区切りのAND検索のみ対応する（PGroongaのOR検索等のクエリ構文は使えない）
+func (s *sqliteStore) Search(opts searchOptions) ([]SearchHit, error) {
+	root := func(alias string) string { return fmt.Sprintf(chainRootColumn, alias) }
+	visible := func(alias string) string { return fmt.Sprintf(visibleCondition, alias) }
+	latest := func(alias string) string { return fmt.Sprintf(latestRowCondition, alias) }
+
+	var params []any
+	param := func(v any) string {
+		params = append(params, v)
+		return fmt.Sprintf("$%d", len(params))
+	}
+
+	keywords := strings.Fields(opts.Query)
+	if len(keywords) == 0 {
+		return []SearchHit{}, nil
+	}
+	conditions := make([]string, 0)
+	for _, k := range keywords {
+		conditions = append(conditions, matchCondition("content", k, param))
+	}
+	for _, k := range strings.Fields(opts.Breadcrumb) {
+		conditions = append(conditions, matchCondition("breadcrumb", k, param))
+	}
+	if len(opts.DocTypes) > 0 {
+		codes := make([]string, len(opts.DocTypes))
+		for i, c := range opts.DocTypes {
+			codes[i] = param(c)
+		}
+		conditions = append(conditions, "M.docTypeCode IN ("+strings.Join(codes, ",")+")")
+	}
+	if !opts.From.IsZero() {
+		conditions = append(conditions, "M.submitDateTime >= "+param(startOfDay(opts.From)))
+	}
+	if !opts.To.IsZero() {
+		conditions = append(conditions, "M.submitDateTime < "+param(startOfDay(opts.To).AddDate(0, 0, 1)))
+	}
+	if !opts.AllVersions {
+		conditions = append(conditions, `NOT EXISTS (
+			SELECT 1 FROM documents M2, document_texts D2
+			WHERE M2.docID = D2.docID
+			AND   `+root("M2")+` = `+root("M")+`
+			AND   `+visible("M2")+`
+			AND   `+latest("M2")+`
+			AND   M2.submitDateTime > M.submitDateTime
+			AND   D2.breadcrumb = D.breadcrumb)`)
+	}
+
+	order := "DESC"
+	if opts.Oldest {
+		order = "ASC"
+	}
+	sqlText := `
+		SELECT M.docID, COALESCE(M.filerName, ''), COALESCE(M.docDescription, ''), COALESCE(M.docTypeCode, ''), M.submitDateTime, D.breadcrumb,
+			D.content,
+			(SELECT L.docID FROM documents L
+			 WHERE ` + root("L") + ` = ` + root("M") + `
+			 AND   ` + visible("L") + `
+			 ORDER BY L.submitDateTime DESC, L.docID DESC LIMIT 1)
+		FROM documents M, document_texts D
+		WHERE M.docID = D.docID
+		AND   ` + visible("M") + `
+		AND   ` + latest("M") + `
+		AND   ` + strings.Join(conditions, "\n\t\tAND   ") + `
+		ORDER BY M.submitDateTime ` + order + ` NULLS LAST, M.docID, D.seq
+		`
+	if opts.Limit > 0 {
+		sqlText += " LIMIT " + param(opts.Limit)
+	}
+
+	rows, err := s.db.Query(sqlText, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hits := make([]SearchHit, 0)
+	for rows.Next() {
+		var h SearchHit
+		var content string
+		var submitDateTime sql.NullTime
+		err = rows.Scan(&h.DocID, &h.FilerName, &h.DocDescription, &h.DocTypeCode, &submitDateTime, &h.Breadcrumb, &content, &h.LatestDocID)
+		if err != nil {
+			return nil, err
+		}
+		h.Snippet = keywordSnippet(content, keywords, 200)
+		h.SubmitDateTime = inJST(submitDateTime)
+		hits = append(hits, h)
+	}
+	return hits, rows.Err()
+}
+
+// document_texts（別名 D）の列にキーワードを含む条件
+// trigram で検索できる長さのキーワードは全文検索インデックスを使い、短いキーワードは LIKE で検索する
+func matchCondition(column, keyword string, param func(v any) string) string {
+	if utf8.RuneCountInString(keyword) >= trigramMinLength {
+		phrase := `"` + strings.ReplaceAll(keyword, `"`, `""`) + `"`
+		return "D.id IN (SELECT rowid FROM document_texts_fts WHERE document_texts_fts MATCH " + param(column+" : "+phrase) + ")"
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(keyword)
+	return "D." + column + " LIKE " + param("%"+escaped+"%") + ` ESCAPE '\'`
+}
+
+// テキストの最初にキーワードが現れる付近を width 文字切り出して、
+// キーワードを <span class="keyword"> で囲んだHTMLにする（pgroonga_snippet_html と同じ形式）
+func keywordSnippet(content string, keywords []string, width int) string {
+	first := -1
+	for _, k := range keywords {
+		if i := strings.Index(content, k); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+	if first < 0 {
+		return ""
+	}
+
+	// キーワードの前も少し含める
+	runes := []rune(content)
+	start := utf8.RuneCountInString(content[:first]) - width/4
+	if start < 0 {
+		start = 0
+	}
+	end := start + width
+	if end > len(runes) {
+		end = len(runes)
+	}
+	text := string(runes[start:end])
+
+	var b strings.Builder
+	for text != "" {
+		pos, length := -1, 0
+		for _, k := range keywords {
+			if i := strings.Index(text, k); i >= 0 && (pos < 0 || i < pos || (i == pos && len(k) > length)) {
+				pos, length = i, len(k)
+			}
+		}
+		if pos < 0 {
+			b.WriteString(html.EscapeString(text))
+			break
+		}
+		b.WriteString(html.EscapeString(text[:pos]))
+		b.WriteString(`<span class="keyword">`)
+		b.WriteString(html.EscapeString(text[pos : pos+length]))
+		b.WriteString(`</span>`)
+		text = text[pos+length:]
+	}
+	return b.String()
+}
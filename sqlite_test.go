@@ -0,0 +1,100 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchCondition(t *testing.T) {
+	tests := []struct {
+		column     string
+		keyword    string
+		want       string
+		wantParams []any
+	}{
+		{"content", "売上高", "D.id IN (SELECT rowid FROM document_texts_fts WHERE document_texts_fts MATCH $1)",
+			[]any{`content : "売上高"`}},
+		{"breadcrumb", `a"bc`, "D.id IN (SELECT rowid FROM document_texts_fts WHERE document_texts_fts MATCH $1)",
+			[]any{`breadcrumb : "a""bc"`}},
+		// trigram で検索できない短いキーワードは LIKE で検索する
+		{"content", "売上", `D.content LIKE $1 ESCAPE '\'`, []any{"%売上%"}},
+		{"breadcrumb", "株", `D.breadcrumb LIKE $1 ESCAPE '\'`, []any{"%株%"}},
+		{"content", "%_", `D.content LIKE $1 ESCAPE '\'`, []any{`%\%\_%`}},
+		{"content", `\`, `D.content LIKE $1 ESCAPE '\'`, []any{`%\\%`}},
+	}
+	for _, tt := range tests {
+		var params []any
+		param := func(v any) string {
+			params = append(params, v)
+			return "$1"
+		}
+		got := matchCondition(tt.column, tt.keyword, param)
+		if got != tt.want || !reflect.DeepEqual(params, tt.wantParams) {
+			t.Errorf("matchCondition(%q, %q) = (%s, %q), want (%s, %q)", tt.column, tt.keyword, got, params, tt.want, tt.wantParams)
+		}
+	}
+}
+
+func TestKeywordSnippet(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		keywords []string
+		width    int
+		want     string
+	}{
+		{"キーワードを囲む", "当期の売上高は増加した", []string{"売上高"}, 200,
+			`当期の<span class="keyword">売上高</span>は増加した`},
+		{"複数のキーワード", "売上高と営業利益", []string{"営業利益", "売上高"}, 200,
+			`<span class="keyword">売上高</span>と<span class="keyword">営業利益</span>`},
+		{"重なる場合は長いキーワード", "売上高", []string{"売上", "売上高"}, 200,
+			`<span class="keyword">売上高</span>`},
+		{"HTMLをエスケープする", "<b>売上</b>&", []string{"売上"}, 200,
+			`&lt;b&gt;<span class="keyword">売上</span>&lt;/b&gt;&amp;`},
+		{"キーワードの付近を切り出す", "あいうえおかきくけこ売上さしすせそ", []string{"売上"}, 8,
+			`けこ<span class="keyword">売上</span>さしすせ`},
+		{"キーワードがない", "売上高", []string{"利益"}, 200, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keywordSnippet(tt.content, tt.keywords, tt.width); got != tt.want {
+				t.Errorf("keywordSnippet = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLiteSearch(t *testing.T) {
+	s := newTestStore(t)
+	saveTestDocument(t, s, newZipArchive(t.TempDir(), s))
+
+	tests := []struct {
+		name string
+		opts searchOptions
+		want []string // 検索結果の目次
+	}{
+		{"全文検索", searchOptions{Query: "売上高"}, []string{testSections[3]}},
+		{"2文字のキーワード", searchOptions{Query: "売上"}, []string{testSections[3]}},
+		{"目次で絞り込む（一致しない）", searchOptions{Query: "設立", Breadcrumb: "事業"}, []string{}},
+		{"1文字のキーワード", searchOptions{Query: "高 売上高"}, []string{testSections[3]}},
+		{"目次で絞り込む（2文字）", searchOptions{Query: "設立", Breadcrumb: "沿革"}, []string{testSections[4]}},
+		{"LIKE の特殊文字はそのまま検索する", searchOptions{Query: "%"}, []string{}},
+		{"LIKE の特殊文字（_）", searchOptions{Query: "_"}, []string{}},
+		{"一致しない", searchOptions{Query: "存在しない語"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits, err := s.Search(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(hits))
+			for _, h := range hits {
+				got = append(got, h.Breadcrumb)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("検索結果 = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
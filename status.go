@@ -0,0 +1,129 @@
+package main
+
+import (
+	"log"
+
+	"yakumo/edinet"
+)
+
+// 書類のステータス（書類一覧APIの値）
+type docStatus struct {
+	Withdrawal  string // 取下区分（0:通常、1:取下書、2:取り下げられた書類）
+	DocInfoEdit string // 書類情報修正区分（0:通常、1:修正情報、2:修正された書類）
+	Disclosure  string // 開示不開示区分（0:通常、1:不開示、2:不開示解除、3:財務局職員による不開示）
+}
+
+// 書類一覧APIの結果からステータスを取得する
+func statusOf(result *edinet.Result) docStatus {
+	return docStatus{
+		Withdrawal:  result.WithdrawalStatus,
+		DocInfoEdit: result.DocInfoEditStatus,
+		Disclosure:  result.DisclosureStatus,
+	}
+}
+
+// 取り下げられた書類か
+func (s docStatus) withdrawn() bool {
+	return s.Withdrawal == "2"
+}
+
+// 不開示の書類か
+func (s docStatus) nonDisclosed() bool {
+	return s.Disclosure == "1" || s.Disclosure == "3"
+}
+
+// 検索結果に表示しない書類か
+func (s docStatus) hidden() bool {
+	return s.withdrawn() || s.nonDisclosed()
+}
+
+// ステータスの変更に伴うテキストの扱い（document_status_log.action に記録する）
+const (
+	statusActionNone  = ""      // なにもしない
+	statusActionPurge = "purge" // 取り下げられたのでテキストを削除する
+	statusActionHide  = "hide"  // 不開示になったので検索結果に表示しない
+	statusActionShow  = "show"  // 不開示が解除されたので検索結果に表示する
+)
+
+// ステータスの変更に伴うテキストの扱いを決める
+// 不開示は解除されることがあるので、テキストは削除せずに検索結果に表示しないだけにする
+func statusAction(before, after docStatus) string {
+	switch {
+	case after.withdrawn():
+		return statusActionPurge
+	case after.nonDisclosed() && !before.nonDisclosed():
+		return statusActionHide
+	case !after.nonDisclosed() && before.nonDisclosed():
+		return statusActionShow
+	}
+	return statusActionNone
+}
+
+// 書類一覧のうち登録済みの書類について、ステータス（取下げ、不開示等）の変更を反映する
+// 取り下げられた書類などは書類種別等の項目が空になるため、処理対象の判定より前に行う
+// 取り下げられた書類は、テキストとともにアーカイブのzipも削除する。
+// 未登録で failed_documents にだけ記録されている書類が取り下げられた、または不開示になった場合は、
+// 再処理で公開されないよう記録を削除する
+func (p *pipeline) applyStatusChanges(results []edinet.Result) error {
+	docIDs := make([]string, 0, len(results))
+	for _, r := range results {
+		docIDs = append(docIDs, r.DocID)
+	}
+	known, err := p.store.DocumentStatuses(docIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		before, ok := known[r.DocID]
+		if !ok {
+			if !statusOf(&r).hidden() {
+				continue
+			}
+			cleared, err := p.store.ClearFailure(r.DocID)
+			if err != nil {
+				return err
+			}
+			if cleared {
+				log.Printf("%s は取り下げられた、または不開示になったため failed_documents から削除しました（取下区分 %s、開示不開示区分 %s）",
+					r.DocID, r.WithdrawalStatus, r.DisclosureStatus)
+			}
+			continue
+		}
+		after := statusOf(&r)
+		if before == after {
+			continue
+		}
+
+		action := statusAction(before, after)
+		log.Printf("%s のステータスが変更されました（取下区分 %s→%s、書類情報修正区分 %s→%s、開示不開示区分 %s→%s）%s",
+			r.DocID, before.Withdrawal, after.Withdrawal, before.DocInfoEdit, after.DocInfoEdit,
+			before.Disclosure, after.Disclosure, action)
+		err = p.store.UpdateDocumentStatus(r.DocID, before, after, r.OpeDateTime, action)
+		if err != nil {
+			return err
+		}
+		if action == statusActionPurge {
+			err = p.purgeArchive(r.DocID)
+			if err != nil {
+				return err
+			}
+		}
+		known[r.DocID] = after
+	}
+	return nil
+}
+
+// 取り下げられた書類のzipを、アーカイブとその記録から削除する
+// アーカイブを使用しない場合に記録がある場合は、zipを削除できないのでログに出力する
+func (p *pipeline) purgeArchive(docID string) error {
+	if p.archive != nil {
+		return p.archive.Purge(docID)
+	}
+	f, err := p.store.ArchivedFile(docID)
+	if err != nil || f == nil {
+		return err
+	}
+	log.Printf("%s は取り下げられましたが、-archive を指定していないためアーカイブのzip（%s）は削除していません", docID, f.Path)
+	return nil
+}
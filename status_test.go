@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"yakumo/edinet"
+	"yakumo/extractor"
+)
+
+func TestStatusAction(t *testing.T) {
+	normal := docStatus{Withdrawal: "0", DocInfoEdit: "0", Disclosure: "0"}
+	tests := []struct {
+		name          string
+		before, after docStatus
+		want          string
+	}{
+		{"変更なし", normal, normal, statusActionNone},
+		{"書類情報の修正", normal, docStatus{Withdrawal: "0", DocInfoEdit: "2", Disclosure: "0"}, statusActionNone},
+		{"取り下げられた", normal, docStatus{Withdrawal: "2", DocInfoEdit: "0", Disclosure: "0"}, statusActionPurge},
+		{"不開示の書類が取り下げられた", docStatus{Withdrawal: "0", Disclosure: "1"}, docStatus{Withdrawal: "2", Disclosure: "1"}, statusActionPurge},
+		{"不開示になった", normal, docStatus{Withdrawal: "0", DocInfoEdit: "0", Disclosure: "1"}, statusActionHide},
+		{"財務局職員による不開示", normal, docStatus{Withdrawal: "0", DocInfoEdit: "0", Disclosure: "3"}, statusActionHide},
+		{"不開示のまま", docStatus{Disclosure: "1"}, docStatus{Disclosure: "3"}, statusActionNone},
+		{"不開示が解除された", docStatus{Disclosure: "1"}, docStatus{Disclosure: "2"}, statusActionShow},
+		{"不開示が解除された（通常）", docStatus{Disclosure: "3"}, docStatus{Disclosure: "0"}, statusActionShow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := statusAction(tt.before, tt.after); got != tt.want {
+				t.Errorf("statusAction = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// テスト用の書類（S100TEST）を、アーカイブに保存して登録する
+func saveTestDocument(t *testing.T, s Store, arc *zipArchive) {
+	t.Helper()
+	r := testResult(t)
+	doc, err := newDocument("2024-06-27", &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext := extractor.Extractor{TempDir: t.TempDir()}
+	parsed, err := ext.ExtractZip("testdata/zip/S100TEST.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.SaveDocument(context.Background(), doc, parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = arc.Put("S100TEST", copyTestZip(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyStatusChanges(t *testing.T) {
+	// 書類一覧に掲載されたステータスの順に反映する
+	type step struct {
+		withdrawal, disclosure string
+		wantHits               int  // 検索結果の件数
+		wantArchived           bool // アーカイブにzipがあるか
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"変更なし", []step{{"0", "0", 1, true}}},
+		{"不開示になり、解除された", []step{{"0", "1", 0, true}, {"0", "2", 1, true}}},
+		{"取り下げられた", []step{{"2", "0", 0, false}}},
+		{"不開示の書類が取り下げられた", []step{{"0", "3", 0, true}, {"2", "3", 0, false}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t)
+			p := &pipeline{store: s, archive: newZipArchive(t.TempDir(), s)}
+			saveTestDocument(t, s, p.archive)
+
+			r := testResult(t)
+			for i, st := range tt.steps {
+				r.WithdrawalStatus = st.withdrawal
+				r.DisclosureStatus = st.disclosure
+				r.OpeDateTime = "2024-06-28 09:00"
+				err := p.applyStatusChanges([]edinet.Result{r})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				statuses, err := s.DocumentStatuses([]string{"S100TEST"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := statuses["S100TEST"]; got != statusOf(&r) {
+					t.Errorf("%d: ステータス = %+v, want %+v", i, got, statusOf(&r))
+				}
+				hits, err := s.Search(searchOptions{Query: "売上高"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(hits) != st.wantHits {
+					t.Errorf("%d: 検索結果 = %d件, want %d件", i, len(hits), st.wantHits)
+				}
+				f, err := s.ArchivedFile("S100TEST")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if (f != nil) != st.wantArchived {
+					t.Errorf("%d: アーカイブの記録 = %v, want %v", i, f != nil, st.wantArchived)
+				}
+				_, err = os.Stat(filepath.Join(p.archive.dir, "TE", "ST", "S100TEST.zip"))
+				if os.IsNotExist(err) == st.wantArchived {
+					t.Errorf("%d: アーカイブのzip = %v, want %v", i, !os.IsNotExist(err), st.wantArchived)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyStatusChangesClearsFailure(t *testing.T) {
+	tests := []struct {
+		name        string
+		withdrawal  string
+		disclosure  string
+		wantCleared bool
+	}{
+		{"変更なし", "0", "0", false},
+		{"取り下げられた", "2", "0", true},
+		{"不開示になった", "0", "1", true},
+		{"財務局職員による不開示", "0", "3", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t)
+			r := testResult(t)
+			err := s.RecordFailure("2024-06-27", r, stageDownload, errors.New("テスト"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// 未登録で failed_documents にだけある書類のステータスが変更された
+			r.WithdrawalStatus = tt.withdrawal
+			r.DisclosureStatus = tt.disclosure
+			err = (&pipeline{store: s}).applyStatusChanges([]edinet.Result{r})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			failed, err := s.FailedDocuments()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cleared := len(failed) == 0; cleared != tt.wantCleared {
+				t.Errorf("削除 = %v, want %v", cleared, tt.wantCleared)
+			}
+		})
+	}
+}